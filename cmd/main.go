@@ -28,14 +28,30 @@ import (
 func main() {
 
 	p := &utils.ConnectionConfig{}
-	p.Initialize()
+	noColor := false
 
 	rootCmd := &cobra.Command{
 		Use:   "knative-diagnose",
 		Short: "A plugin of Knative Client to show detail information of Knative Resources for diagnose purpose",
 		Long:  `It can be used to show the Knative Customer Resource Definition Hierarchy in a tree view, to show the status and key metadata and spec fileds of different Knative Customer Resource Definitions`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			//the clients are created once the flags are parsed, so that --qps and --burst apply
+			if err := p.Initialize(); err != nil && diagnose.NeedsCluster(cmd, args) {
+				return err
+			}
+			utils.InitColor(noColor)
+			return diagnose.InitRedaction()
+		},
 	}
+	diagnose.AddRedactionFlags(rootCmd.PersistentFlags())
+	diagnose.AddClientFlags(rootCmd.PersistentFlags(), p)
+	p.AddFlags(rootCmd.PersistentFlags())
+	rootCmd.PersistentFlags().BoolVarP(&noColor, "no-color", "", false, "disable the colors, also disabled when NO_COLOR is set or the output is not a terminal")
 	rootCmd.AddCommand(diagnose.NewServiceCmd(p))
+	rootCmd.AddCommand(diagnose.NewWaitCmd(p))
+	rootCmd.AddCommand(diagnose.NewDiffCmd(p))
+	rootCmd.AddCommand(diagnose.NewRevisionCmd(p))
+	rootCmd.AddCommand(diagnose.NewConfigCmd(p))
 	rootCmd.InitDefaultHelpCmd()
 
 	if err := rootCmd.Execute(); err != nil {
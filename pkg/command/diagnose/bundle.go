@@ -0,0 +1,378 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+
+	"knative.dev/kn-plugin-diag/pkg/command"
+	. "knative.dev/kn-plugin-diag/pkg/models"
+	. "knative.dev/kn-plugin-diag/pkg/utils"
+)
+
+const (
+	servingNamespace   = "knative-serving"
+	bundleLogTailLines = int64(1000)
+	bundleManifestFile = "manifest.yaml"
+)
+
+var (
+	eventsGVR     = schema.GroupVersionResource{Group: "", Version: "v1", Resource: "events"}
+	configMapsGVR = schema.GroupVersionResource{Group: "", Version: "v1", Resource: "configmaps"}
+	podsGVR       = schema.GroupVersionResource{Group: "", Version: "v1", Resource: "pods"}
+
+	// servingConfigMaps are the ConfigMaps of knative-serving which influence a ksvc
+	servingConfigMaps = []string{
+		"config-autoscaler",
+		"config-defaults",
+		"config-deployment",
+		"config-domain",
+		"config-features",
+		"config-gc",
+		"config-network",
+	}
+)
+
+// BundleManifest describes the content of a diagnostic bundle
+type BundleManifest struct {
+	Tool             BundleToolInfo `json:"tool"`
+	ClusterVersion   string         `json:"clusterVersion,omitempty"`
+	ServingVersion   string         `json:"servingVersion,omitempty"`
+	Service          string         `json:"service"`
+	Namespace        string         `json:"namespace"`
+	CreatedAt        string         `json:"createdAt"`
+	Objects          []BundleObject `json:"objects"`
+	Files            []string       `json:"files"`
+	CollectionErrors []string       `json:"collectionErrors,omitempty"`
+}
+
+type BundleToolInfo struct {
+	Version     string `json:"version,omitempty"`
+	GitRevision string `json:"gitRevision,omitempty"`
+	BuildDate   string `json:"buildDate,omitempty"`
+}
+
+// BundleObject links a file of the bundle to the node of the object tree it was loaded for
+type BundleObject struct {
+	CRName string `json:"crName"`
+	Name   string `json:"name"`
+	File   string `json:"file"`
+}
+
+type bundleWriter struct {
+	file     *os.File
+	gzip     *gzip.Writer
+	tar      *tar.Writer
+	manifest *BundleManifest
+	now      time.Time
+}
+
+func newBundleWriter(fileName string) (*bundleWriter, error) {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create bundle %s, %v", fileName, err)
+	}
+	gz := gzip.NewWriter(f)
+	now := time.Now()
+	return &bundleWriter{
+		file:     f,
+		gzip:     gz,
+		tar:      tar.NewWriter(gz),
+		manifest: &BundleManifest{CreatedAt: now.UTC().Format(time.RFC3339)},
+		now:      now,
+	}, nil
+}
+
+func (bw *bundleWriter) addFile(name string, content []byte) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(content)),
+		ModTime: bw.now,
+	}
+	if err := bw.tar.WriteHeader(header); err != nil {
+		return err
+	}
+	if _, err := bw.tar.Write(content); err != nil {
+		return err
+	}
+	bw.manifest.Files = append(bw.manifest.Files, name)
+	return nil
+}
+
+func (bw *bundleWriter) addYAML(name string, obj interface{}) error {
+	content, err := yaml.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return bw.addFile(name, content)
+}
+
+// collectionError records a piece of information which could not be collected, the bundle is still written
+func (bw *bundleWriter) collectionError(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	SayWarningMessage("%s\n", msg)
+	bw.manifest.CollectionErrors = append(bw.manifest.CollectionErrors, msg)
+}
+
+func (bw *bundleWriter) close() error {
+	if err := bw.addYAML(bundleManifestFile, bw.manifest); err != nil {
+		return err
+	}
+	if err := bw.tar.Close(); err != nil {
+		return err
+	}
+	if err := bw.gzip.Close(); err != nil {
+		return err
+	}
+	return bw.file.Close()
+}
+
+// writeBundle captures every object of the tree of sc together with the related events, pod logs,
+// Serving ConfigMaps and control plane logs into a gzipped tarball
+func writeBundle(ctx context.Context, sc *ServingConfiguration, clientSet kubernetes.Interface, fileName string) (err error) {
+	bw, err := newBundleWriter(fileName)
+	if err != nil {
+		return err
+	}
+	//a partial bundle can not be read back, so it is not left behind
+	defer func() {
+		if err != nil {
+			bw.file.Close()
+			os.Remove(fileName)
+		}
+	}()
+
+	bw.manifest.Service = sc.ksvcName
+	bw.manifest.Namespace = sc.Namespace
+	bw.manifest.Tool = BundleToolInfo{
+		Version:     command.Version,
+		GitRevision: command.GitRevision,
+		BuildDate:   command.BuildDate,
+	}
+	if clientSet != nil {
+		if info, err := clientSet.Discovery().ServerVersion(); err == nil {
+			bw.manifest.ClusterVersion = info.GitVersion
+		} else {
+			bw.collectionError("Failed to load the cluster version, %v", err)
+		}
+	}
+	if ns, err := sc.dynClient.Resource(schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}).Get(ctx, servingNamespace, metav1.GetOptions{}); err == nil {
+		bw.manifest.ServingVersion = ns.GetLabels()["app.kubernetes.io/version"]
+	}
+
+	if err := bw.addObjects(sc.printable().report.Root); err != nil {
+		return err
+	}
+	if err := bw.addEvents(ctx, sc); err != nil {
+		return err
+	}
+	if err := bw.addServingConfigMaps(ctx, sc); err != nil {
+		return err
+	}
+	if err := bw.addResourceConstraints(ctx, sc); err != nil {
+		return err
+	}
+	if clientSet != nil {
+		if err := bw.addPodLogs(ctx, clientSet, findReportNodes(sc.report.Root, "pod"), "logs", sc.redactor); err != nil {
+			return err
+		}
+		if err := bw.addControlPlane(ctx, sc, clientSet); err != nil {
+			return err
+		}
+	}
+	return bw.close()
+}
+
+func (bw *bundleWriter) addObjects(node *ReportNode) error {
+	if node == nil {
+		return nil
+	}
+	if node.Object != nil {
+		name := path.Join("objects", node.Type, node.Name+".yaml")
+		if err := bw.addYAML(name, node.Object.Object); err != nil {
+			return err
+		}
+		bw.manifest.Objects = append(bw.manifest.Objects, BundleObject{
+			CRName: node.Type,
+			Name:   node.Name,
+			File:   name,
+		})
+	}
+	for _, leaf := range node.Children {
+		if err := bw.addObjects(leaf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addEvents adds the events of the namespace which involve an object of the tree
+func (bw *bundleWriter) addEvents(ctx context.Context, sc *ServingConfiguration) error {
+	events, err := sc.relatedEvents(ctx)
+	if err != nil {
+		bw.collectionError("Failed to load events of namespace %s, %v", sc.Namespace, err)
+		return nil
+	}
+	items := []interface{}{}
+	for _, event := range events {
+		items = append(items, event.Object)
+	}
+	return bw.addYAML("events/events.yaml", map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "List",
+		"items":      items,
+	})
+}
+
+// relatedEvents returns the events of the namespace which involve an object of the tree
+func (sc *ServingConfiguration) relatedEvents(ctx context.Context) ([]unstructured.Unstructured, error) {
+	uids := make(map[string]bool)
+	var walk func(*ReportNode)
+	walk = func(node *ReportNode) {
+		if node == nil {
+			return
+		}
+		if node.Object != nil {
+			uids[string(node.Object.GetUID())] = true
+		}
+		for _, leaf := range node.Children {
+			walk(leaf)
+		}
+	}
+	walk(sc.report.Root)
+
+	events, err := sc.dynClient.Resource(eventsGVR).Namespace(sc.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	related := []unstructured.Unstructured{}
+	for _, event := range events.Items {
+		uid, _, _ := unstructured.NestedString(event.Object, "involvedObject", "uid")
+		if uid != "" && uids[uid] {
+			sc.redactor.RedactObject(event.Object)
+			related = append(related, event)
+		}
+	}
+	return related, nil
+}
+
+func (bw *bundleWriter) addServingConfigMaps(ctx context.Context, sc *ServingConfiguration) error {
+	for _, name := range servingConfigMaps {
+		cm, err := sc.dynClient.Resource(configMapsGVR).Namespace(servingNamespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			bw.collectionError("Failed to load configmap %s/%s, %v", servingNamespace, name, err)
+			continue
+		}
+		sc.redactor.RedactObject(cm.Object)
+		if err := bw.addYAML(path.Join("configmaps", name+".yaml"), cm.Object); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addResourceConstraints adds the ResourceQuotas and LimitRanges of the namespace, which bound the pods of the revisions
+func (bw *bundleWriter) addResourceConstraints(ctx context.Context, sc *ServingConfiguration) error {
+	for _, gvr := range []schema.GroupVersionResource{resourceQuotasGVR, limitRangesGVR} {
+		list, err := sc.dynClient.Resource(gvr).Namespace(sc.Namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			bw.collectionError("Failed to list the %s of namespace %s, %v", gvr.Resource, sc.Namespace, err)
+			continue
+		}
+		for _, item := range list.Items {
+			if err := bw.addYAML(path.Join("constraints", gvr.Resource, item.GetName()+".yaml"), item.Object); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addControlPlane adds the pods of knative-serving and their logs
+func (bw *bundleWriter) addControlPlane(ctx context.Context, sc *ServingConfiguration, clientSet kubernetes.Interface) error {
+	pods, err := sc.dynClient.Resource(podsGVR).Namespace(servingNamespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		bw.collectionError("Failed to load pods of %s, %v", servingNamespace, err)
+		return nil
+	}
+	nodes := []*ReportNode{}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		sc.redactor.RedactObject(pod.Object)
+		if err := bw.addYAML(path.Join("control-plane", "pods", pod.GetName()+".yaml"), pod.Object); err != nil {
+			return err
+		}
+		nodes = append(nodes, &ReportNode{Type: "pod", Name: pod.GetName(), Object: pod})
+	}
+	return bw.addPodLogs(ctx, clientSet, nodes, path.Join("control-plane", "logs"), sc.redactor)
+}
+
+// addPodLogs adds the tail of the logs of each container, and of its previous instance if it restarted
+func (bw *bundleWriter) addPodLogs(ctx context.Context, clientSet kubernetes.Interface, pods []*ReportNode, dir string, redactor *Redactor) error {
+	for _, pod := range pods {
+		statuses, _, _ := unstructured.NestedSlice(pod.Object.Object, "status", "containerStatuses")
+		for _, status := range statuses {
+			m, ok := status.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			container := fmt.Sprintf("%v", m["name"])
+			restartCount, _, _ := unstructured.NestedInt64(m, "restartCount")
+			if err := bw.addContainerLog(ctx, clientSet, pod, container, false, dir, redactor); err != nil {
+				return err
+			}
+			if restartCount > 0 {
+				if err := bw.addContainerLog(ctx, clientSet, pod, container, true, dir, redactor); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (bw *bundleWriter) addContainerLog(ctx context.Context, clientSet kubernetes.Interface, pod *ReportNode, container string, previous bool, dir string, redactor *Redactor) error {
+	tailLines := bundleLogTailLines
+	content, err := clientSet.CoreV1().Pods(pod.Object.GetNamespace()).GetLogs(pod.Name, &corev1.PodLogOptions{
+		Container: container,
+		TailLines: &tailLines,
+		Previous:  previous,
+	}).DoRaw(ctx)
+	if err != nil {
+		bw.collectionError("Failed to load logs of container %s in pod %s, %v", container, pod.Name, err)
+		return nil
+	}
+	name := container + ".log"
+	if previous {
+		name = container + ".previous.log"
+	}
+	return bw.addFile(path.Join(dir, pod.Name, name), []byte(redactor.RedactText(string(content))))
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+
+	. "knative.dev/kn-plugin-diag/pkg/utils"
+)
+
+// readBundleFiles returns the content of the files of a bundle by name
+func readBundleFiles(t *testing.T, fileName string) map[string]string {
+	f, err := os.Open(fileName)
+	assert.NilError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	assert.NilError(t, err)
+	tr := tar.NewReader(gz)
+	files := make(map[string]string)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		assert.NilError(t, err)
+		content, err := io.ReadAll(tr)
+		assert.NilError(t, err)
+		files[header.Name] = string(content)
+	}
+	return files
+}
+
+func TestWriteBundle(t *testing.T) {
+	object := func(apiVersion, kind, namespace, name string, fields map[string]interface{}) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: fields}
+		if obj.Object == nil {
+			obj.Object = map[string]interface{}{}
+		}
+		obj.SetAPIVersion(apiVersion)
+		obj.SetKind(kind)
+		obj.SetNamespace(namespace)
+		obj.SetName(name)
+		return obj
+	}
+	ksvc := object("serving.knative.dev/v1", "Service", "demo", "hello", map[string]interface{}{
+		"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{"containers": []interface{}{
+			map[string]interface{}{"image": "ghcr.io/knative/hello", "env": []interface{}{map[string]interface{}{"name": "TOKEN", "value": "s3cret"}}},
+		}}}},
+		"status": map[string]interface{}{"latestCreatedRevisionName": "hello-00001"},
+	})
+	ksvc.SetUID("ksvc-uid")
+	servingNs := object("v1", "Namespace", "", servingNamespace, nil)
+	servingNs.SetLabels(map[string]string{"app.kubernetes.io/version": "1.10.0"})
+	objects := []*unstructured.Unstructured{
+		ksvc,
+		servingNs,
+		object("v1", "Event", "demo", "hello.1", map[string]interface{}{
+			"involvedObject": map[string]interface{}{"kind": "Service", "name": "hello", "uid": "ksvc-uid"},
+			"reason":         "Created",
+		}),
+		object("v1", "Event", "demo", "other.1", map[string]interface{}{
+			"involvedObject": map[string]interface{}{"kind": "Service", "name": "other", "uid": "other-uid"},
+			"reason":         "Created",
+		}),
+		object("v1", "ConfigMap", servingNamespace, "config-domain", map[string]interface{}{"data": map[string]interface{}{"example.com": ""}}),
+		object("v1", "ResourceQuota", "demo", "quota", map[string]interface{}{"spec": map[string]interface{}{"hard": map[string]interface{}{"pods": "10"}}}),
+	}
+	client, err := newOfflineDynamicClient(objects, "demo")
+	assert.NilError(t, err)
+	sc, err := newServingConfigurationForClient("hello", "demo", client)
+	assert.NilError(t, err)
+	sc.redactor, err = NewRedactor(nil)
+	assert.NilError(t, err)
+
+	fileName := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	assert.NilError(t, writeBundle(context.Background(), sc, nil, fileName))
+	files := readBundleFiles(t, fileName)
+
+	manifest := &BundleManifest{}
+	assert.NilError(t, yaml.Unmarshal([]byte(files[bundleManifestFile]), manifest))
+	assert.Equal(t, manifest.Service, "hello")
+	assert.Equal(t, manifest.Namespace, "demo")
+	assert.Equal(t, manifest.ServingVersion, "1.10.0")
+	assert.DeepEqual(t, manifest.Objects, []BundleObject{{CRName: "ksvc", Name: "hello", File: "objects/ksvc/hello.yaml"}})
+	//the ConfigMaps which are missing are recorded, the bundle is still written
+	assert.Equal(t, len(manifest.CollectionErrors), len(servingConfigMaps)-1)
+	assert.Assert(t, strings.HasPrefix(manifest.CollectionErrors[0], "Failed to load configmap knative-serving/config-autoscaler"))
+
+	//the objects are redacted
+	assert.Assert(t, strings.Contains(files["objects/ksvc/hello.yaml"], "TOKEN"))
+	assert.Assert(t, !strings.Contains(files["objects/ksvc/hello.yaml"], "s3cret"))
+	//only the events of the tree are kept
+	assert.Assert(t, strings.Contains(files["events/events.yaml"], "hello.1"))
+	assert.Assert(t, !strings.Contains(files["events/events.yaml"], "other.1"))
+	assert.Assert(t, strings.Contains(files["configmaps/config-domain.yaml"], "example.com"))
+	assert.Assert(t, strings.Contains(files["constraints/resourcequotas/quota.yaml"], "pods: \"10\""))
+	for name := range files {
+		if name != bundleManifestFile {
+			assert.Assert(t, contains(manifest.Files, name), "%s not in the manifest", name)
+		}
+	}
+}
+
+func TestWriteBundleFailure(t *testing.T) {
+	client, err := newOfflineDynamicClient(nil, "demo")
+	assert.NilError(t, err)
+	sc := newServingConfiguration("hello", "demo", client, nil)
+	err = writeBundle(context.Background(), sc, nil, filepath.Join(t.TempDir(), "missing", "bundle.tar.gz"))
+	assert.ErrorContains(t, err, "Failed to create bundle")
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"github.com/spf13/pflag"
+
+	. "knative.dev/kn-plugin-diag/pkg/utils"
+)
+
+var (
+	// fetchConcurrency bounds the number of requests sent at a time while loading the object hierarchy
+	fetchConcurrency int
+)
+
+// AddClientFlags adds the flags tuning how fast the cluster is queried
+func AddClientFlags(flags *pflag.FlagSet, p *ConnectionConfig) {
+	flags.IntVarP(&fetchConcurrency, "concurrency", "", 8, "the maximum number of requests sent at a time while loading the resources")
+	flags.Float32VarP(&p.QPS, "qps", "", 50, "the maximum queries per second to the API server")
+	flags.IntVarP(&p.Burst, "burst", "", 100, "the maximum burst of queries to the API server")
+}
@@ -0,0 +1,471 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	networkingconfig "knative.dev/networking/pkg/config"
+	servingconfig "knative.dev/serving/pkg/apis/config"
+	autoscalerconfig "knative.dev/serving/pkg/autoscaler/config"
+	"knative.dev/serving/pkg/deployment"
+	"knative.dev/serving/pkg/gc"
+	routeconfig "knative.dev/serving/pkg/reconciler/route/config"
+
+	. "knative.dev/kn-plugin-diag/pkg/utils"
+)
+
+var configChanged bool
+
+// servingConfigParser parses a ConfigMap of knative-serving with the types of Knative Serving
+type servingConfigParser struct {
+	name  string
+	parse func(data map[string]string) (interface{}, error)
+	// defaultData is the data parsed for the defaults, for the ConfigMaps which have a required key
+	defaultData func(data map[string]string) map[string]string
+	// deprecated maps the legacy keys to the keys replacing them
+	deprecated map[string]string
+	// validate returns why the value of a key is ignored, if it is
+	validate func(key, value string) string
+	// keys are the keys read by Knative Serving besides the deprecated ones, nil for the ConfigMaps whose keys
+	// are free, e.g. the domains of config-domain
+	keys []string
+}
+
+var servingConfigParsers = []servingConfigParser{
+	{
+		name: servingconfig.DefaultsConfigName,
+		parse: func(data map[string]string) (interface{}, error) {
+			return servingconfig.NewDefaultsConfigFromMap(data)
+		},
+		//NewDefaultsConfigFromMap reads its keys as literals
+		keys: []string{
+			"init-container-name-template",
+			"container-name-template",
+			"allow-container-concurrency-zero",
+			"enable-service-links",
+			"revision-timeout-seconds",
+			"max-revision-timeout-seconds",
+			"revision-idle-timeout-seconds",
+			"revision-response-start-timeout-seconds",
+			"container-concurrency",
+			"container-concurrency-max-limit",
+			"revision-cpu-request",
+			"revision-memory-request",
+			"revision-ephemeral-storage-request",
+			"revision-cpu-limit",
+			"revision-memory-limit",
+			"revision-ephemeral-storage-limit",
+		},
+	},
+	{
+		name: deployment.ConfigName,
+		parse: func(data map[string]string) (interface{}, error) {
+			return deployment.NewConfigFromMap(data)
+		},
+		//the image of the queue-proxy has no default, it is set by the installation
+		defaultData: func(data map[string]string) map[string]string {
+			image := data[deployment.QueueSidecarImageKey]
+			if image == "" {
+				image = data[deployment.DeprecatedQueueSidecarImageKey]
+			}
+			return map[string]string{deployment.QueueSidecarImageKey: image}
+		},
+		deprecated: map[string]string{
+			deployment.DeprecatedQueueSidecarImageKey: deployment.QueueSidecarImageKey,
+			"progressDeadline":                        deployment.ProgressDeadlineKey,
+			"digestResolutionTimeout":                 "digest-resolution-timeout",
+			"registriesSkippingTagResolving":          "registries-skipping-tag-resolving",
+			"queueSidecarCPURequest":                  "queue-sidecar-cpu-request",
+			"queueSidecarMemoryRequest":               "queue-sidecar-memory-request",
+			"queueSidecarEphemeralStorageRequest":     "queue-sidecar-ephemeral-storage-request",
+			"queueSidecarCPULimit":                    "queue-sidecar-cpu-limit",
+			"queueSidecarMemoryLimit":                 "queue-sidecar-memory-limit",
+			"queueSidecarEphemeralStorageLimit":       "queue-sidecar-ephemeral-storage-limit",
+		},
+		//only the first two keys are exported by the deployment package
+		keys: []string{
+			deployment.QueueSidecarImageKey,
+			deployment.ProgressDeadlineKey,
+			"digest-resolution-timeout",
+			"registries-skipping-tag-resolving",
+			"queue-sidecar-cpu-request",
+			"queue-sidecar-memory-request",
+			"queue-sidecar-ephemeral-storage-request",
+			"queue-sidecar-cpu-limit",
+			"queue-sidecar-memory-limit",
+			"queue-sidecar-ephemeral-storage-limit",
+			"queue-sidecar-token-audiences",
+			"queue-sidecar-rootca",
+			"default-affinity-type",
+		},
+	},
+	{
+		name: networkingconfig.ConfigMapName,
+		parse: func(data map[string]string) (interface{}, error) {
+			return networkingconfig.NewConfigFromMap(data)
+		},
+		deprecated: map[string]string{
+			"ingress.class":                        networkingconfig.DefaultIngressClassKey,
+			"certificate.class":                    networkingconfig.DefaultCertificateClassKey,
+			"domainTemplate":                       networkingconfig.DomainTemplateKey,
+			"tagTemplate":                          networkingconfig.TagTemplateKey,
+			"rolloutDuration":                      networkingconfig.RolloutDurationKey,
+			"autocreateClusterDomainClaims":        networkingconfig.AutocreateClusterDomainClaimsKey,
+			"defaultExternalScheme":                networkingconfig.DefaultExternalSchemeKey,
+			"httpProtocol":                         networkingconfig.HTTPProtocolKey,
+			"autoTLS":                              networkingconfig.ExternalDomainTLSKey,
+			networkingconfig.AutoTLSKey:            networkingconfig.ExternalDomainTLSKey,
+			networkingconfig.InternalEncryptionKey: networkingconfig.SystemInternalTLSKey,
+		},
+		keys: []string{
+			networkingconfig.DefaultIngressClassKey,
+			networkingconfig.DefaultCertificateClassKey,
+			networkingconfig.DomainTemplateKey,
+			networkingconfig.TagTemplateKey,
+			networkingconfig.RolloutDurationKey,
+			networkingconfig.AutocreateClusterDomainClaimsKey,
+			networkingconfig.DefaultExternalSchemeKey,
+			networkingconfig.EnableMeshPodAddressabilityKey,
+			networkingconfig.MeshCompatibilityModeKey,
+			networkingconfig.NamespaceWildcardCertSelectorKey,
+			networkingconfig.ExternalDomainTLSKey,
+			networkingconfig.ClusterLocalDomainTLSKey,
+			networkingconfig.HTTPProtocolKey,
+			networkingconfig.SystemInternalTLSKey,
+		},
+	},
+	{
+		name: routeconfig.DomainConfigName,
+		parse: func(data map[string]string) (interface{}, error) {
+			return routeconfig.NewDomainFromConfigMap(&corev1.ConfigMap{Data: data})
+		},
+	},
+	{
+		name: servingconfig.FeaturesConfigName,
+		parse: func(data map[string]string) (interface{}, error) {
+			return servingconfig.NewFeaturesConfigFromMap(data)
+		},
+		//an unknown value of a feature flag is silently ignored by Knative Serving
+		validate: func(key, value string) string {
+			for _, flag := range []servingconfig.Flag{servingconfig.Enabled, servingconfig.Allowed, servingconfig.Disabled} {
+				if strings.EqualFold(value, string(flag)) {
+					return ""
+				}
+			}
+			return fmt.Sprintf("the value %q is ignored, it must be one of %s, %s or %s", value, servingconfig.Enabled, servingconfig.Allowed, servingconfig.Disabled)
+		},
+		//NewFeaturesConfigFromMap reads its flags as literals
+		keys: []string{
+			"multi-container",
+			"multi-container-probing",
+			"kubernetes.podspec-affinity",
+			"kubernetes.podspec-topologyspreadconstraints",
+			"kubernetes.podspec-dryrun",
+			"kubernetes.podspec-hostaliases",
+			"kubernetes.podspec-fieldref",
+			"kubernetes.podspec-nodeselector",
+			"kubernetes.podspec-runtimeclassname",
+			"kubernetes.podspec-securitycontext",
+			"kubernetes.podspec-shareprocessnamespace",
+			"kubernetes.podspec-priorityclassname",
+			"kubernetes.podspec-schedulername",
+			"kubernetes.containerspec-addcapabilities",
+			"kubernetes.podspec-tolerations",
+			"kubernetes.podspec-volumes-emptydir",
+			"kubernetes.podspec-init-containers",
+			"kubernetes.podspec-persistent-volume-claim",
+			"kubernetes.podspec-persistent-volume-write",
+			"kubernetes.podspec-dnspolicy",
+			"kubernetes.podspec-dnsconfig",
+			"secure-pod-defaults",
+			"tag-header-based-routing",
+			"queueproxy.resource-defaults",
+			"queueproxy.mount-podinfo",
+			"autodetect-http2",
+		},
+	},
+	{
+		name: gc.ConfigName,
+		parse: func(data map[string]string) (interface{}, error) {
+			return gc.NewConfigFromConfigMapFunc(context.Background())(&corev1.ConfigMap{Data: data})
+		},
+		keys: []string{
+			"retain-since-create-time",
+			"retain-since-last-active-time",
+			"min-non-active-revisions",
+			"max-non-active-revisions",
+		},
+	},
+	{
+		name: autoscalerconfig.ConfigName,
+		parse: func(data map[string]string) (interface{}, error) {
+			return autoscalerconfig.NewConfigFromMap(data)
+		},
+		keys: []string{
+			"pod-autoscaler-class",
+			"enable-scale-to-zero",
+			"allow-zero-initial-scale",
+			"max-scale-up-rate",
+			"max-scale-down-rate",
+			"container-concurrency-target-percentage",
+			"container-concurrency-target-default",
+			"requests-per-second-target-default",
+			"target-burst-capacity",
+			"panic-window-percentage",
+			"activator-capacity",
+			"panic-threshold-percentage",
+			"initial-scale",
+			"min-scale",
+			"max-scale",
+			"max-scale-limit",
+			"stable-window",
+			"scale-down-delay",
+			"scale-to-zero-grace-period",
+			"scale-to-zero-pod-retention-period",
+		},
+	},
+}
+
+// configIssue is a key of a ConfigMap which does not do what it looks like
+type configIssue struct {
+	key     string
+	message string
+}
+
+// NewConfigCmd represents the config command
+func NewConfigCmd(p *ConnectionConfig) *cobra.Command {
+	var configCmd = &cobra.Command{
+		Use:   "config",
+		Short: "kn-diag config",
+		Long: `Show the effective configuration of Knative Serving, parsed from the ConfigMaps of knative-serving,
+next to the defaults, and flag the invalid, unknown and deprecated keys. For example
+kn-diag config
+kn-diag config --changed`,
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dynClient, _, err := loadDynamicClient(cmd, servingNamespace, p)
+			if err != nil {
+				return err
+			}
+			for i, parser := range servingConfigParsers {
+				if i > 0 {
+					fmt.Println()
+				}
+				if err := printServingConfig(cmd.Context(), dynClient, parser); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+
+	configCmd.Flags().BoolVarP(&configChanged, "changed", "", false, "only show the settings which differ from the defaults")
+	configCmd.Flags().StringVarP(&fromBundle, "from-bundle", "", "", "read the ConfigMaps of a bundle written by 'kn-diag service --bundle' instead of the cluster")
+	configCmd.Flags().StringVarP(&fromDir, "from-dir", "", "", "read the ConfigMaps from the YAML or JSON dumps in a directory instead of the cluster")
+	return configCmd
+}
+
+// printServingConfig prints the settings of a ConfigMap with their defaults, followed by the issues of its keys
+func printServingConfig(ctx context.Context, dynClient dynamic.Interface, parser servingConfigParser) error {
+	data := map[string]string{}
+	cm, err := dynClient.Resource(configMapsGVR).Namespace(servingNamespace).Get(ctx, parser.name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		fmt.Printf("ConfigMap %s/%s (not found, the defaults apply)\n", servingNamespace, parser.name)
+	case err != nil:
+		return fmt.Errorf("Failed to load configmap %s/%s, %v", servingNamespace, parser.name, err)
+	default:
+		fmt.Printf("ConfigMap %s/%s\n", servingNamespace, parser.name)
+		cmData, _, _ := unstructured.NestedStringMap(cm.Object, "data")
+		for key, value := range cmData {
+			//the keys starting with `_`, e.g. `_example`, are documentation
+			if !strings.HasPrefix(key, "_") {
+				data[key] = value
+			}
+		}
+	}
+
+	effective, err := parser.parse(data)
+	issues := []configIssue{}
+	if err != nil {
+		issues = append(issues, configIssue{message: fmt.Sprintf("invalid, Knative Serving keeps its previous configuration: %v", err)})
+		effective = nil
+	}
+	defaultData := map[string]string{}
+	if parser.defaultData != nil {
+		defaultData = parser.defaultData(data)
+	}
+	//the parse functions return a typed nil on error, which configRows must not dereference
+	defaults, err := parser.parse(defaultData)
+	if err != nil {
+		defaults = nil
+	}
+	issues = append(issues, parser.keyIssues(data)...)
+
+	table := NewTable(os.Stdout, []string{"Setting", "Value", "Default", "Source"})
+	table.SetSeperator(false)
+	for _, row := range configRows(effective, defaults) {
+		if configChanged && row[3] == "default" {
+			continue
+		}
+		table.Add(row)
+	}
+	table.Print()
+
+	c := color.New(color.FgRed)
+	for _, issue := range issues {
+		if issue.key == "" {
+			fmt.Println(c.Sprintf("* %s", issue.message))
+			continue
+		}
+		fmt.Println(c.Sprintf("* %s: %s", issue.key, issue.message))
+	}
+	return nil
+}
+
+// keyIssues flags the deprecated keys, the ignored values and the keys which Knative Serving does not read
+func (parser servingConfigParser) keyIssues(data map[string]string) []configIssue {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	issues := []configIssue{}
+	for _, key := range keys {
+		if replacement, ok := parser.deprecated[key]; ok {
+			message := fmt.Sprintf("deprecated, use %s instead", replacement)
+			if _, ok := data[replacement]; ok {
+				message = fmt.Sprintf("deprecated and overridden by %s", replacement)
+			}
+			issues = append(issues, configIssue{key: key, message: message})
+			continue
+		}
+		if parser.keys != nil && !parser.readsKey(key) {
+			issues = append(issues, configIssue{key: key, message: "unknown key, ignored by Knative Serving"})
+			continue
+		}
+		if parser.validate != nil {
+			if message := parser.validate(key, data[key]); message != "" {
+				issues = append(issues, configIssue{key: key, message: message})
+			}
+		}
+	}
+	return issues
+}
+
+// readsKey tells whether key is one of the keys read by Knative Serving
+func (parser servingConfigParser) readsKey(key string) bool {
+	for _, known := range parser.keys {
+		if key == known {
+			return true
+		}
+	}
+	return false
+}
+
+// configRows lists the exported fields of the parsed configuration next to their defaults
+func configRows(effective, defaults interface{}) [][]string {
+	reference := effective
+	if reference == nil {
+		reference = defaults
+	}
+	if reference == nil {
+		return nil
+	}
+	rows := [][]string{}
+	structType := reflect.Indirect(reflect.ValueOf(reference)).Type()
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		value, defaultValue := "<invalid>", "<none>"
+		if effective != nil {
+			value = configValue(reflect.Indirect(reflect.ValueOf(effective)).Field(i))
+		}
+		if defaults != nil {
+			defaultValue = configValue(reflect.Indirect(reflect.ValueOf(defaults)).Field(i))
+		}
+		source := "default"
+		switch {
+		case effective == nil:
+			source = "invalid"
+		case value != defaultValue:
+			source = "configmap"
+		}
+		rows = append(rows, []string{field.Name, value, defaultValue, source})
+	}
+	return rows
+}
+
+// configValue formats a field of a parsed configuration
+func configValue(v reflect.Value) string {
+	if !v.IsValid() || !v.CanInterface() {
+		return ""
+	}
+	if t, ok := v.Interface().(*template.Template); ok {
+		if t == nil || t.Tree == nil {
+			return ""
+		}
+		return t.Tree.Root.String()
+	}
+	if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Map) && v.IsNil() {
+		return "<none>"
+	}
+	if stringer, ok := v.Interface().(fmt.Stringer); ok {
+		return stringer.String()
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		return configValue(v.Elem())
+	case reflect.Map:
+		entries := []string{}
+		for _, key := range v.MapKeys() {
+			entry := fmt.Sprintf("%v", key.Interface())
+			if value := configValue(v.MapIndex(key)); value != "" {
+				entry = entry + "=" + value
+			}
+			entries = append(entries, entry)
+		}
+		sort.Strings(entries)
+		return strings.Join(entries, ",")
+	case reflect.Struct:
+		fields := []string{}
+		for i := 0; i < v.NumField(); i++ {
+			if value := configValue(v.Field(i)); value != "" {
+				fields = append(fields, value)
+			}
+		}
+		return strings.Join(fields, " ")
+	}
+	return fmt.Sprintf("%v", v.Interface())
+}
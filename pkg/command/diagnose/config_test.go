@@ -0,0 +1,95 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gotest.tools/v3/assert"
+)
+
+const unknownKey = "unknown key, ignored by Knative Serving"
+
+func TestKeyIssues(t *testing.T) {
+	tests := []struct {
+		configMap string
+		data      map[string]string
+		want      []configIssue
+	}{
+		{
+			configMap: "config-defaults",
+			data:      map[string]string{"revision-timeout-seconds": "300", "revision-timout-seconds": "300"},
+			want:      []configIssue{{key: "revision-timout-seconds", message: unknownKey}},
+		},
+		{
+			configMap: "config-deployment",
+			data: map[string]string{
+				"queue-sidecar-image":            "gcr.io/knative-releases/queue",
+				"progress-deadlin":               "600s",
+				"registriesSkippingTagResolving": "kind.local",
+			},
+			want: []configIssue{
+				{key: "progress-deadlin", message: unknownKey},
+				{key: "registriesSkippingTagResolving", message: "deprecated, use registries-skipping-tag-resolving instead"},
+			},
+		},
+		{
+			configMap: "config-network",
+			data:      map[string]string{"ingress-class": "kourier.ingress.networking.knative.dev", "domain-templat": "{{.Name}}", "autoTLS": "Enabled", "external-domain-tls": "Enabled"},
+			want: []configIssue{
+				{key: "autoTLS", message: "deprecated and overridden by external-domain-tls"},
+				{key: "domain-templat", message: unknownKey},
+			},
+		},
+		{
+			configMap: "config-domain",
+			data:      map[string]string{"example.com": ""},
+			want:      []configIssue{},
+		},
+		{
+			configMap: "config-features",
+			data:      map[string]string{"multi-container": "enabled", "kubernetes.podspec-afinity": "enabled", "kubernetes.podspec-fieldref": "on"},
+			want: []configIssue{
+				{key: "kubernetes.podspec-afinity", message: unknownKey},
+				{key: "kubernetes.podspec-fieldref", message: `the value "on" is ignored, it must be one of Enabled, Allowed or Disabled`},
+			},
+		},
+		{
+			configMap: "config-gc",
+			data:      map[string]string{"max-non-active-revisions": "10", "max-non-active-revision": "10"},
+			want:      []configIssue{{key: "max-non-active-revision", message: unknownKey}},
+		},
+		{
+			configMap: "config-autoscaler",
+			data:      map[string]string{"enable-scale-to-zero": "false", "stable-windows": "60s"},
+			want:      []configIssue{{key: "stable-windows", message: unknownKey}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.configMap, func(t *testing.T) {
+			var parser *servingConfigParser
+			for i := range servingConfigParsers {
+				if servingConfigParsers[i].name == tt.configMap {
+					parser = &servingConfigParsers[i]
+				}
+			}
+			assert.Assert(t, parser != nil)
+			assert.DeepEqual(t, parser.keyIssues(tt.data), tt.want, cmp.AllowUnexported(configIssue{}))
+		})
+	}
+}
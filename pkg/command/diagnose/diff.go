@@ -0,0 +1,322 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"knative.dev/serving/pkg/apis/serving"
+
+	. "knative.dev/kn-plugin-diag/pkg/models"
+	. "knative.dev/kn-plugin-diag/pkg/utils"
+)
+
+// liveSource is the diff source standing for the cluster
+const liveSource = "live"
+
+var (
+	diffNamespace string
+	diffService   string
+)
+
+// NewDiffCmd represents the diff command
+func NewDiffCmd(p *ConnectionConfig) *cobra.Command {
+	var diffCmd = &cobra.Command{
+		Use:   "diff",
+		Short: "kn-diag diff",
+		Long: `Compare the diagnosis of a knative service between two sources. A source is a bundle written
+by 'kn-diag service --bundle', a directory of YAML dumps or 'live' for the cluster. For example
+kn-diag diff yesterday.tar.gz today.tar.gz
+kn-diag diff yesterday.tar.gz live`,
+
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf(`'diff' requires two sources to compare.
+For example: kn-diag diff <bundleA> <bundleB>`)
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			sources := make([]*diffSource, 2)
+			for i, arg := range args {
+				source, err := openDiffSource(arg)
+				if err != nil {
+					return err
+				}
+				sources[i] = source
+			}
+
+			//the service and namespace default to the ones of the bundles
+			ksvcName, Namespace := diffService, diffNamespace
+			for _, source := range sources {
+				if source.manifest == nil {
+					continue
+				}
+				if ksvcName == "" {
+					ksvcName = source.manifest.Service
+				}
+				if Namespace == "" {
+					Namespace = source.manifest.Namespace
+				}
+			}
+			if ksvcName == "" {
+				return fmt.Errorf("Missing the knative service name, please set it with --service")
+			}
+			if Namespace == "" {
+				Namespace = resolveNamespace(cmd, diffNamespace, p)
+			}
+
+			configurations := make([]*ServingConfiguration, 2)
+			for i, source := range sources {
+				sc, err := source.load(ksvcName, Namespace, p)
+				if err != nil {
+					return err
+				}
+				configurations[i] = sc
+			}
+
+			table := NewTable(os.Stdout, []string{"Resource Type", "Name", "Change", args[0], args[1]})
+			table.SetSeperator(false)
+			viewA, viewB := configurations[0].printable(), configurations[1].printable()
+			rows := diffObjectNodes(configurations[0].report.Root, configurations[1].report.Root, viewA.report.Root, viewB.report.Root, 0)
+			if len(rows) == 0 {
+				fmt.Printf("No difference found for ksvc %s in namespace %s\n", ksvcName, Namespace)
+				return nil
+			}
+			for _, row := range rows {
+				table.Add(row)
+			}
+			table.Print()
+			return nil
+		},
+	}
+
+	diffCmd.Flags().StringVarP(&diffNamespace, "namespace", "n", "", "the target namespace, defaults to the namespace of the bundles")
+	diffCmd.Flags().StringVarP(&diffService, "service", "", "", "the knative service name, defaults to the service of the bundles")
+	return diffCmd
+}
+
+// diffSource is one side of a diff: the cluster, a bundle or a directory of dumps
+type diffSource struct {
+	name     string
+	objects  []*unstructured.Unstructured
+	manifest *BundleManifest
+}
+
+func openDiffSource(name string) (*diffSource, error) {
+	source := &diffSource{name: name}
+	if name == liveSource {
+		return source, nil
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid diff source %s, %v", name, err)
+	}
+	if info.IsDir() {
+		source.objects, err = loadDir(name)
+	} else {
+		source.objects, source.manifest, err = loadBundle(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return source, nil
+}
+
+func (source *diffSource) load(ksvcName, Namespace string, p *ConnectionConfig) (*ServingConfiguration, error) {
+	if source.name == liveSource {
+		return NewServingConfiguration(ksvcName, Namespace, p)
+	}
+	dynClient, err := newOfflineDynamicClient(source.objects, Namespace)
+	if err != nil {
+		return nil, err
+	}
+	return newServingConfigurationForClient(ksvcName, Namespace, dynClient)
+}
+
+// diffObjectNodes aligns the two trees with diffNodeKeys and returns one row per difference. The real values
+// of nodeA and nodeB are compared, and the redacted ones of shownA and shownB, the nodes at the same place
+// of the redacted trees, are shown.
+func diffObjectNodes(nodeA, nodeB, shownA, shownB *ReportNode, depth int) [][]string {
+	rows := [][]string{}
+	switch {
+	case nodeA == nil && nodeB == nil:
+		return rows
+	case nodeA == nil:
+		return append(rows, diffRow(depth, nodeB, "added", "", "present"))
+	case nodeB == nil:
+		return append(rows, diffRow(depth, nodeA, "removed", "present", ""))
+	}
+
+	if nodeA.Name != nodeB.Name {
+		rows = append(rows, diffRow(depth, nodeA, "name", nodeA.Name, nodeB.Name))
+	}
+
+	conditionsA, conditionsB := conditionValues(nodeA), conditionValues(nodeB)
+	shownConditionsA, shownConditionsB := conditionValues(shownA), conditionValues(shownB)
+	for _, key := range unionKeys(conditionsA, conditionsB) {
+		if differs(conditionsA[key], conditionsB[key], shownConditionsA[key], shownConditionsB[key]) {
+			valueA, valueB := shownValues(shownConditionsA[key], shownConditionsB[key])
+			rows = append(rows, diffRow(depth, nodeA, "condition "+key, valueA, valueB))
+		}
+	}
+	keyInfosA, keyInfosB := keyInfoValues(nodeA), keyInfoValues(nodeB)
+	shownKeyInfosA, shownKeyInfosB := keyInfoValues(shownA), keyInfoValues(shownB)
+	for _, key := range unionKeys(keyInfosA, keyInfosB) {
+		if differs(keyInfosA[key], keyInfosB[key], shownKeyInfosA[key], shownKeyInfosB[key]) {
+			valueA, valueB := shownValues(shownKeyInfosA[key], shownKeyInfosB[key])
+			rows = append(rows, diffRow(depth, nodeA, "keyinfo "+key, valueA, valueB))
+		}
+	}
+
+	//keep the order of A and append the children only found in B
+	keysA, keysB := diffNodeKeys(nodeA.Children), diffNodeKeys(nodeB.Children)
+	indexesB := make(map[string]int)
+	for i := range nodeB.Children {
+		indexesB[keysB[i]] = i
+	}
+	matched := make(map[string]bool)
+	for i, child := range nodeA.Children {
+		matched[keysA[i]] = true
+		var childB, shownChildB *ReportNode
+		if j, ok := indexesB[keysA[i]]; ok {
+			childB, shownChildB = nodeB.Children[j], shownB.Children[j]
+		}
+		rows = append(rows, diffObjectNodes(child, childB, shownA.Children[i], shownChildB, depth+1)...)
+	}
+	for i, child := range nodeB.Children {
+		if !matched[keysB[i]] {
+			rows = append(rows, diffObjectNodes(nil, child, nil, shownB.Children[i], depth+1)...)
+		}
+	}
+	return rows
+}
+
+// diffNodeKeys returns the keys aligning the leaves of a node with the ones of the other tree. The names of the
+// revisions, deployments and pods change when the ksvc is recreated, a new revision is created or the pods
+// restart, so a single revision and the deployment are aligned by their type, several revisions by the generation
+// of their configuration, the replicasets by their pod template hash and the pods by their position among the
+// pods of the same hash. The other nodes are aligned by name.
+func diffNodeKeys(leaves []*ReportNode) []string {
+	revisions := 0
+	for _, leaf := range leaves {
+		if leaf.Type == "revision" {
+			revisions++
+		}
+	}
+	keys := make([]string, len(leaves))
+	positions := make(map[string]int)
+	for i, leaf := range leaves {
+		keys[i] = objectNodeKey(leaf)
+		switch leaf.Type {
+		case "revision":
+			if revisions == 1 {
+				keys[i] = leaf.Type
+				continue
+			}
+			if leaf.Object == nil {
+				continue
+			}
+			if generation, ok := leaf.Object.GetLabels()[serving.ConfigurationGenerationLabelKey]; ok {
+				keys[i] = fmt.Sprintf("%s/generation %s", leaf.Type, generation)
+			}
+		case "deployment":
+			keys[i] = leaf.Type
+		case "replicaset":
+			if hash := podTemplateHash(leaf); hash != "" {
+				keys[i] = fmt.Sprintf("%s/hash %s", leaf.Type, hash)
+			}
+		case "pod":
+			owner := podTemplateHash(leaf)
+			keys[i] = fmt.Sprintf("%s/hash %s#%d", leaf.Type, owner, positions[owner])
+			positions[owner]++
+		}
+	}
+	return keys
+}
+
+// podTemplateHash returns the pod-template-hash label of a replicaset or a pod, or else the name of the
+// replicaset owning the pod
+func podTemplateHash(node *ReportNode) string {
+	if node.Object == nil {
+		return ""
+	}
+	if hash, ok := node.Object.GetLabels()["pod-template-hash"]; ok {
+		return hash
+	}
+	for _, owner := range node.Object.GetOwnerReferences() {
+		if owner.Kind == "ReplicaSet" {
+			return owner.Name
+		}
+	}
+	return ""
+}
+
+// differs tells whether a value changed between the two trees. A value redacted on one side, e.g. by the bundle
+// it was loaded from, can not be compared to the real value of the other side, so both sides are compared
+// redacted then.
+func differs(valueA, valueB, shownA, shownB string) bool {
+	if strings.Contains(valueA, Redacted) || strings.Contains(valueB, Redacted) {
+		return shownA != shownB
+	}
+	return valueA != valueB
+}
+
+func diffRow(depth int, node *ReportNode, change, valueA, valueB string) []string {
+	padding := ""
+	if depth > 0 {
+		padding = strings.Repeat("    ", depth-1) + "|---"
+	}
+	return []string{padding + node.Type, node.Name, change, valueA, valueB}
+}
+
+// conditionValues maps the condition types of the node to `status reason`
+func conditionValues(node *ReportNode) map[string]string {
+	values := make(map[string]string)
+	for _, condition := range node.Conditions {
+		values[condition.Type] = strings.TrimSpace(condition.Status + " " + condition.Reason)
+	}
+	return values
+}
+
+// keyInfoValues maps the keyinfo paths of the node to their values
+func keyInfoValues(node *ReportNode) map[string]string {
+	values := make(map[string]string)
+	for _, info := range node.KeyInfo {
+		values[info.Key] = info.Value
+	}
+	return values
+}
+
+func unionKeys(a, b map[string]string) []string {
+	keys := []string{}
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	. "knative.dev/kn-plugin-diag/pkg/models"
+)
+
+func TestDiffNodeKeys(t *testing.T) {
+	revision := func(name, generation string) *ReportNode {
+		object := &unstructured.Unstructured{Object: map[string]interface{}{}}
+		if generation != "" {
+			object.SetLabels(map[string]string{"serving.knative.dev/configurationGeneration": generation})
+		}
+		return &ReportNode{Type: "revision", Name: name, Object: object}
+	}
+	replicaset := func(name, hash string) *ReportNode {
+		object := &unstructured.Unstructured{Object: map[string]interface{}{}}
+		if hash != "" {
+			object.SetLabels(map[string]string{"pod-template-hash": hash})
+		}
+		return &ReportNode{Type: "replicaset", Name: name, Object: object}
+	}
+	pod := func(name, hash, owner string) *ReportNode {
+		object := &unstructured.Unstructured{Object: map[string]interface{}{}}
+		if hash != "" {
+			object.SetLabels(map[string]string{"pod-template-hash": hash})
+		}
+		if owner != "" {
+			object.SetOwnerReferences([]metav1.OwnerReference{{Kind: "ReplicaSet", Name: owner}})
+		}
+		return &ReportNode{Type: "pod", Name: name, Object: object}
+	}
+	tests := []struct {
+		name   string
+		leaves []*ReportNode
+		want   []string
+	}{
+		{
+			name:   "revisions by configuration generation",
+			leaves: []*ReportNode{revision("hello-v1", "1"), revision("hello-v2", "2")},
+			want:   []string{"revision/generation 1", "revision/generation 2"},
+		},
+		{
+			name:   "revision without the label by name",
+			leaves: []*ReportNode{revision("hello-00001", ""), {Type: "revision", Name: "hello-00002", Object: nil}},
+			want:   []string{"revision/hello-00001", "revision/hello-00002"},
+		},
+		{
+			name:   "single revision by type",
+			leaves: []*ReportNode{{Type: "route", Name: "hello", Object: nil}, revision("hello-00002", "2")},
+			want:   []string{"route/hello", "revision"},
+		},
+		{
+			name: "deployment by type and replicaset by hash",
+			leaves: []*ReportNode{
+				{Type: "kpa", Name: "hello-00001", Object: nil},
+				{Type: "deployment", Name: "hello-00001-deployment", Object: nil},
+				replicaset("hello-00001-deployment-abc", "abc"),
+				replicaset("hello-00001-deployment-def", ""),
+			},
+			want: []string{"kpa/hello-00001", "deployment", "replicaset/hash abc", "replicaset/hello-00001-deployment-def"},
+		},
+		{
+			name: "pods by hash and position",
+			leaves: []*ReportNode{
+				pod("hello-00001-deployment-abc-xyz", "abc", ""),
+				pod("hello-00001-deployment-def-xyz", "", "hello-00001-deployment-def"),
+				pod("hello-00001-deployment-abc-uvw", "abc", ""),
+			},
+			want: []string{"pod/hash abc#0", "pod/hash hello-00001-deployment-def#0", "pod/hash abc#1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.DeepEqual(t, diffNodeKeys(tt.leaves), tt.want)
+		})
+	}
+}
+
+func TestDiffers(t *testing.T) {
+	tests := []struct {
+		name                           string
+		valueA, valueB, shownA, shownB string
+		want                           bool
+	}{
+		{name: "same values", valueA: "a", valueB: "a", shownA: "a", shownB: "a", want: false},
+		{name: "changed values", valueA: "a", valueB: "b", shownA: "a", shownB: "b", want: true},
+		{name: "changed and redacted on both sides", valueA: "s3cret", valueB: "other", shownA: "<redacted>", shownB: "<redacted>", want: true},
+		{name: "redacted on one side only", valueA: "s3cret", valueB: "<redacted>", shownA: "<redacted>", shownB: "<redacted>", want: false},
+		{name: "redacted on one side and changed", valueA: "TOKEN=s3cret v2", valueB: "TOKEN=<redacted> v1", shownA: "TOKEN=<redacted> v2", shownB: "TOKEN=<redacted> v1", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, differs(tt.valueA, tt.valueB, tt.shownA, tt.shownB), tt.want)
+		})
+	}
+}
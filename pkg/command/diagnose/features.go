@@ -0,0 +1,326 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/fatih/color"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	servingconfig "knative.dev/serving/pkg/apis/config"
+
+	. "knative.dev/kn-plugin-diag/pkg/utils"
+)
+
+var checkFeatures bool
+
+// gatedFeature is a field of the pod spec which the webhook of Knative Serving only accepts when its
+// flag of config-features allows it
+type gatedFeature struct {
+	key  string
+	flag func(features *servingconfig.Features) servingconfig.Flag
+	// enabledOnly is set for the flags which have to be Enabled, Allowed is enough for the others
+	enabledOnly bool
+	// used returns the paths of the gated fields set in the pod spec of the template
+	used func(podSpec map[string]interface{}, features *servingconfig.Features) []string
+	// unsupported returns the paths of the fields under the gate which the webhook drops whatever the flag
+	unsupported func(podSpec map[string]interface{}) []string
+}
+
+// podTemplatePath is the path of the pod spec in the ksvc
+const podTemplatePath = "spec.template.spec"
+
+var gatedFeatures = []gatedFeature{
+	{
+		key:         "multi-container",
+		flag:        func(f *servingconfig.Features) servingconfig.Flag { return f.MultiContainer },
+		enabledOnly: true,
+		used: func(podSpec map[string]interface{}, _ *servingconfig.Features) []string {
+			if containers, _, _ := unstructured.NestedSlice(podSpec, "containers"); len(containers) > 1 {
+				return []string{fmt.Sprintf("%s.containers (%d containers)", podTemplatePath, len(containers))}
+			}
+			return nil
+		},
+	},
+	{
+		key:         "multi-container-probing",
+		flag:        func(f *servingconfig.Features) servingconfig.Flag { return f.MultiContainerProbing },
+		enabledOnly: true,
+		used: func(podSpec map[string]interface{}, _ *servingconfig.Features) []string {
+			//the probes of the sidecars, the serving container is the one exposing a port
+			paths := []string{}
+			containers, _, _ := unstructured.NestedSlice(podSpec, "containers")
+			if len(containers) < 2 {
+				return nil
+			}
+			for i, container := range containers {
+				c, ok := container.(map[string]interface{})
+				if !ok || c["ports"] != nil {
+					continue
+				}
+				for _, probe := range []string{"livenessProbe", "readinessProbe"} {
+					if c[probe] != nil {
+						paths = append(paths, fmt.Sprintf("%s.containers[%d].%s", podTemplatePath, i, probe))
+					}
+				}
+			}
+			return paths
+		},
+	},
+	podSpecFeature("kubernetes.podspec-affinity", "affinity", func(f *servingconfig.Features) servingconfig.Flag { return f.PodSpecAffinity }),
+	podSpecFeature("kubernetes.podspec-topologyspreadconstraints", "topologySpreadConstraints", func(f *servingconfig.Features) servingconfig.Flag { return f.PodSpecTopologySpreadConstraints }),
+	podSpecFeature("kubernetes.podspec-hostaliases", "hostAliases", func(f *servingconfig.Features) servingconfig.Flag { return f.PodSpecHostAliases }),
+	podSpecFeature("kubernetes.podspec-nodeselector", "nodeSelector", func(f *servingconfig.Features) servingconfig.Flag { return f.PodSpecNodeSelector }),
+	podSpecFeature("kubernetes.podspec-runtimeclassname", "runtimeClassName", func(f *servingconfig.Features) servingconfig.Flag { return f.PodSpecRuntimeClassName }),
+	podSpecFeature("kubernetes.podspec-tolerations", "tolerations", func(f *servingconfig.Features) servingconfig.Flag { return f.PodSpecTolerations }),
+	podSpecFeature("kubernetes.podspec-shareprocessnamespace", "shareProcessNamespace", func(f *servingconfig.Features) servingconfig.Flag { return f.PodSpecShareProcessNamespace }),
+	podSpecFeature("kubernetes.podspec-priorityclassname", "priorityClassName", func(f *servingconfig.Features) servingconfig.Flag { return f.PodSpecPriorityClassName }),
+	podSpecFeature("kubernetes.podspec-schedulername", "schedulerName", func(f *servingconfig.Features) servingconfig.Flag { return f.PodSpecSchedulerName }),
+	podSpecFeature("kubernetes.podspec-init-containers", "initContainers", func(f *servingconfig.Features) servingconfig.Flag { return f.PodSpecInitContainers }),
+	podSpecFeature("kubernetes.podspec-dnspolicy", "dnsPolicy", func(f *servingconfig.Features) servingconfig.Flag { return f.PodSpecDNSPolicy }),
+	podSpecFeature("kubernetes.podspec-dnsconfig", "dnsConfig", func(f *servingconfig.Features) servingconfig.Flag { return f.PodSpecDNSConfig }),
+	{
+		key:  "kubernetes.podspec-securitycontext",
+		flag: func(f *servingconfig.Features) servingconfig.Flag { return f.PodSpecSecurityContext },
+		used: func(podSpec map[string]interface{}, features *servingconfig.Features) []string {
+			paths := []string{}
+			securityContext, _, _ := unstructured.NestedMap(podSpec, "securityContext")
+			for _, field := range sortedKeys(securityContext) {
+				if !podSecurityContextFields[field] {
+					continue
+				}
+				if field != "seccompProfile" {
+					paths = append(paths, podTemplatePath+".securityContext."+field)
+					continue
+				}
+				//secure-pod-defaults lets the RuntimeDefault and Unconfined seccomp profiles through on their own
+				profile, _, _ := unstructured.NestedString(securityContext, "seccompProfile", "type")
+				if features.SecurePodDefaults == servingconfig.Enabled && (profile == "RuntimeDefault" || profile == "Unconfined") {
+					continue
+				}
+				paths = append(paths, fmt.Sprintf("%s.securityContext.seccompProfile (type %s)", podTemplatePath, profile))
+			}
+			return paths
+		},
+		unsupported: func(podSpec map[string]interface{}) []string {
+			paths := []string{}
+			securityContext, _, _ := unstructured.NestedMap(podSpec, "securityContext")
+			for _, field := range sortedKeys(securityContext) {
+				if !podSecurityContextFields[field] {
+					paths = append(paths, podTemplatePath+".securityContext."+field)
+				}
+			}
+			return paths
+		},
+	},
+	{
+		key:         "kubernetes.containerspec-addcapabilities",
+		flag:        func(f *servingconfig.Features) servingconfig.Flag { return f.ContainerSpecAddCapabilities },
+		enabledOnly: true,
+		used: func(podSpec map[string]interface{}, features *servingconfig.Features) []string {
+			return containerPaths(podSpec, func(container map[string]interface{}) bool {
+				add, _, _ := unstructured.NestedStringSlice(container, "securityContext", "capabilities", "add")
+				//secure-pod-defaults lets NET_BIND_SERVICE through on its own
+				if len(add) == 1 && add[0] == "NET_BIND_SERVICE" && features.SecurePodDefaults == servingconfig.Enabled {
+					return false
+				}
+				return len(add) > 0
+			}, "securityContext.capabilities.add")
+		},
+	},
+	{
+		key:  "kubernetes.podspec-fieldref",
+		flag: func(f *servingconfig.Features) servingconfig.Flag { return f.PodSpecFieldRef },
+		used: func(podSpec map[string]interface{}, _ *servingconfig.Features) []string {
+			return containerPaths(podSpec, func(container map[string]interface{}) bool {
+				env, _, _ := unstructured.NestedSlice(container, "env")
+				for _, e := range env {
+					if m, ok := e.(map[string]interface{}); ok {
+						valueFrom, _, _ := unstructured.NestedMap(m, "valueFrom")
+						if valueFrom["fieldRef"] != nil || valueFrom["resourceFieldRef"] != nil {
+							return true
+						}
+					}
+				}
+				return false
+			}, "env[*].valueFrom.fieldRef")
+		},
+	},
+	volumeFeature("kubernetes.podspec-volumes-emptydir", "emptyDir", func(f *servingconfig.Features) servingconfig.Flag { return f.PodSpecVolumesEmptyDir }),
+	volumeFeature("kubernetes.podspec-persistent-volume-claim", "persistentVolumeClaim", func(f *servingconfig.Features) servingconfig.Flag { return f.PodSpecPersistentVolumeClaim }),
+	{
+		key:         "kubernetes.podspec-persistent-volume-write",
+		flag:        func(f *servingconfig.Features) servingconfig.Flag { return f.PodSpecPersistentVolumeWrite },
+		enabledOnly: true,
+		used: func(podSpec map[string]interface{}, _ *servingconfig.Features) []string {
+			paths := []string{}
+			volumes, _, _ := unstructured.NestedSlice(podSpec, "volumes")
+			for i, volume := range volumes {
+				v, ok := volume.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if pvc, ok := v["persistentVolumeClaim"].(map[string]interface{}); ok && pvc["readOnly"] != true {
+					paths = append(paths, fmt.Sprintf("%s.volumes[%d].persistentVolumeClaim (not readOnly)", podTemplatePath, i))
+				}
+			}
+			return paths
+		},
+	},
+}
+
+// podSecurityContextFields are the fields of the pod securityContext kept by the webhook when the flag allows them,
+// like PodSecurityContextMask of Knative Serving. The others, e.g. seLinuxOptions, windowsOptions, sysctls and
+// fsGroupChangePolicy, are always dropped.
+var podSecurityContextFields = map[string]bool{
+	"runAsUser":          true,
+	"runAsGroup":         true,
+	"runAsNonRoot":       true,
+	"fsGroup":            true,
+	"supplementalGroups": true,
+	"seccompProfile":     true,
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// podSpecFeature gates a field of the pod spec
+func podSpecFeature(key, field string, flag func(*servingconfig.Features) servingconfig.Flag) gatedFeature {
+	return gatedFeature{
+		key:  key,
+		flag: flag,
+		used: func(podSpec map[string]interface{}, _ *servingconfig.Features) []string {
+			if value, ok := podSpec[field]; ok && value != nil && value != "" && value != false {
+				return []string{podTemplatePath + "." + field}
+			}
+			return nil
+		},
+	}
+}
+
+// volumeFeature gates a type of volume
+func volumeFeature(key, volumeType string, flag func(*servingconfig.Features) servingconfig.Flag) gatedFeature {
+	return gatedFeature{
+		key:  key,
+		flag: flag,
+		used: func(podSpec map[string]interface{}, _ *servingconfig.Features) []string {
+			paths := []string{}
+			volumes, _, _ := unstructured.NestedSlice(podSpec, "volumes")
+			for i, volume := range volumes {
+				if v, ok := volume.(map[string]interface{}); ok && v[volumeType] != nil {
+					paths = append(paths, fmt.Sprintf("%s.volumes[%d].%s", podTemplatePath, i, volumeType))
+				}
+			}
+			return paths
+		},
+	}
+}
+
+// containerPaths returns the path of field for every container, init containers included, matching used
+func containerPaths(podSpec map[string]interface{}, used func(container map[string]interface{}) bool, field string) []string {
+	paths := []string{}
+	for _, kind := range []string{"initContainers", "containers"} {
+		containers, _, _ := unstructured.NestedSlice(podSpec, kind)
+		for i, container := range containers {
+			if c, ok := container.(map[string]interface{}); ok && used(c) {
+				paths = append(paths, fmt.Sprintf("%s.%s[%d].%s", podTemplatePath, kind, i, field))
+			}
+		}
+	}
+	return paths
+}
+
+// featureUse is a gated field used by the ksvc template, with the flag which allows it. An unsupported
+// field is never allowed, whatever the flag.
+type featureUse struct {
+	path        string
+	key         string
+	value       servingconfig.Flag
+	enabledOnly bool
+	allowed     bool
+	unsupported bool
+}
+
+// checkGatedFeatures walks the pod spec of the ksvc template and returns the gated fields it uses
+func checkGatedFeatures(ksvc *unstructured.Unstructured, features *servingconfig.Features) []featureUse {
+	podSpec, _, _ := unstructured.NestedMap(ksvc.Object, "spec", "template", "spec")
+	uses := []featureUse{}
+	for _, feature := range gatedFeatures {
+		value := feature.flag(features)
+		allowed := value == servingconfig.Enabled || (!feature.enabledOnly && value == servingconfig.Allowed)
+		for _, path := range feature.used(podSpec, features) {
+			uses = append(uses, featureUse{path: path, key: feature.key, value: value, enabledOnly: feature.enabledOnly, allowed: allowed})
+		}
+		if feature.unsupported == nil {
+			continue
+		}
+		for _, path := range feature.unsupported(podSpec) {
+			uses = append(uses, featureUse{path: path, key: feature.key, value: value, enabledOnly: feature.enabledOnly, unsupported: true})
+		}
+	}
+	return uses
+}
+
+// printFeatureCheck prints the gated fields used by the ksvc template and whether config-features allows them
+func printFeatureCheck(sc *ServingConfiguration) {
+	if sc.report.Root == nil || sc.report.Root.Object == nil {
+		return
+	}
+	uses := checkGatedFeatures(sc.report.Root.Object, sc.loadFeaturesConfig())
+	fmt.Println()
+	if len(uses) == 0 {
+		fmt.Printf("No gated feature is used by ksvc %s\n", sc.ksvcName)
+		return
+	}
+	fmt.Printf("Gated features used by ksvc %s, the flags are set in %s/%s\n", sc.ksvcName, servingNamespace, servingconfig.FeaturesConfigName)
+	c := color.New(color.FgRed).Add(color.Bold)
+	table := NewTable(os.Stdout, []string{"Field", "Feature Flag", "Value", "Status"})
+	table.SetSeperator(false)
+	for _, use := range uses {
+		status := "allowed"
+		switch {
+		case use.unsupported:
+			status = c.Sprintf("rejected, not supported by Knative Serving whatever the flag")
+		case !use.allowed:
+			status = c.Sprintf("rejected, needs %s", servingconfig.Enabled)
+			if !use.enabledOnly {
+				status = c.Sprintf("rejected, needs %s or %s", servingconfig.Enabled, servingconfig.Allowed)
+			}
+		}
+		table.Add([]string{use.path, use.key, string(use.value), status})
+	}
+	table.Print()
+}
+
+// loadFeaturesConfig returns the parsed config-features, which falls back to the defaults of Knative Serving
+// when the ConfigMap can not be loaded or parsed
+func (sc *ServingConfiguration) loadFeaturesConfig() *servingconfig.Features {
+	features, err := servingconfig.NewFeaturesConfigFromMap(sc.loadServingConfigMap(servingconfig.FeaturesConfigName))
+	if err != nil {
+		sc.warn("Invalid configmap %s/%s, the defaults of Knative Serving are used, %v\n", servingNamespace, servingconfig.FeaturesConfigName, err)
+		features, _ = servingconfig.NewFeaturesConfigFromMap(nil)
+	}
+	return features
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gotest.tools/v3/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	servingconfig "knative.dev/serving/pkg/apis/config"
+)
+
+var cmpFeatureUse = cmp.AllowUnexported(featureUse{})
+
+func TestCheckGatedFeaturesSecurityContext(t *testing.T) {
+	tests := []struct {
+		name            string
+		features        map[string]string
+		securityContext map[string]interface{}
+		want            []featureUse
+	}{
+		{
+			name:            "allowed fields need the flag",
+			securityContext: map[string]interface{}{"runAsUser": int64(1000), "fsGroup": int64(2000)},
+			want: []featureUse{
+				{path: "spec.template.spec.securityContext.fsGroup", key: "kubernetes.podspec-securitycontext", value: servingconfig.Disabled},
+				{path: "spec.template.spec.securityContext.runAsUser", key: "kubernetes.podspec-securitycontext", value: servingconfig.Disabled},
+			},
+		},
+		{
+			name:            "allowed fields with the flag",
+			features:        map[string]string{"kubernetes.podspec-securitycontext": "enabled"},
+			securityContext: map[string]interface{}{"runAsNonRoot": true},
+			want: []featureUse{
+				{path: "spec.template.spec.securityContext.runAsNonRoot", key: "kubernetes.podspec-securitycontext", value: servingconfig.Enabled, allowed: true},
+			},
+		},
+		{
+			name:     "unsupported fields whatever the flag",
+			features: map[string]string{"kubernetes.podspec-securitycontext": "enabled"},
+			securityContext: map[string]interface{}{
+				"sysctls":             []interface{}{map[string]interface{}{"name": "net.core.somaxconn", "value": "1024"}},
+				"fsGroupChangePolicy": "OnRootMismatch",
+			},
+			want: []featureUse{
+				{path: "spec.template.spec.securityContext.fsGroupChangePolicy", key: "kubernetes.podspec-securitycontext", value: servingconfig.Enabled, unsupported: true},
+				{path: "spec.template.spec.securityContext.sysctls", key: "kubernetes.podspec-securitycontext", value: servingconfig.Enabled, unsupported: true},
+			},
+		},
+		{
+			name:            "runtime default seccomp with secure pod defaults",
+			features:        map[string]string{"secure-pod-defaults": "enabled"},
+			securityContext: map[string]interface{}{"seccompProfile": map[string]interface{}{"type": "RuntimeDefault"}},
+			want:            []featureUse{},
+		},
+		{
+			name:            "localhost seccomp with secure pod defaults",
+			features:        map[string]string{"secure-pod-defaults": "enabled"},
+			securityContext: map[string]interface{}{"seccompProfile": map[string]interface{}{"type": "Localhost", "localhostProfile": "audit.json"}},
+			want: []featureUse{
+				{path: "spec.template.spec.securityContext.seccompProfile (type Localhost)", key: "kubernetes.podspec-securitycontext", value: servingconfig.Disabled},
+			},
+		},
+		{
+			name:            "runtime default seccomp without secure pod defaults",
+			securityContext: map[string]interface{}{"seccompProfile": map[string]interface{}{"type": "RuntimeDefault"}},
+			want: []featureUse{
+				{path: "spec.template.spec.securityContext.seccompProfile (type RuntimeDefault)", key: "kubernetes.podspec-securitycontext", value: servingconfig.Disabled},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			features, err := servingconfig.NewFeaturesConfigFromMap(tt.features)
+			assert.NilError(t, err)
+			ksvc := &unstructured.Unstructured{Object: map[string]interface{}{
+				"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{
+					"containers":      []interface{}{map[string]interface{}{"image": "ghcr.io/knative/helloworld-go"}},
+					"securityContext": tt.securityContext,
+				}}},
+			}}
+			assert.DeepEqual(t, checkGatedFeatures(ksvc, features), tt.want, cmpFeatureUse)
+		})
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// hpaMetricSources maps the type of an autoscaling/v2 metric to the field holding its source
+var hpaMetricSources = map[string]string{
+	"Resource":          "resource",
+	"ContainerResource": "containerResource",
+	"Pods":              "pods",
+	"Object":            "object",
+	"External":          "external",
+}
+
+// hpaSummary shows the current and desired replicas of a HorizontalPodAutoscaler and the current value
+// of each metric against its target, e.g. `replicas 2/3 (min 1, max 10), cpu 85%/70%`
+func hpaSummary(hpa *unstructured.Unstructured) string {
+	current, _, _ := unstructured.NestedInt64(hpa.Object, "status", "currentReplicas")
+	desired, _, _ := unstructured.NestedInt64(hpa.Object, "status", "desiredReplicas")
+	minReplicas, ok, _ := unstructured.NestedInt64(hpa.Object, "spec", "minReplicas")
+	if !ok {
+		minReplicas = 1
+	}
+	maxReplicas, _, _ := unstructured.NestedInt64(hpa.Object, "spec", "maxReplicas")
+	parts := []string{fmt.Sprintf("replicas %d/%d (min %d, max %d)", current, desired, minReplicas, maxReplicas)}
+
+	targets := make(map[string]string)
+	specMetrics, _, _ := unstructured.NestedSlice(hpa.Object, "spec", "metrics")
+	for _, metric := range specMetrics {
+		if m, ok := metric.(map[string]interface{}); ok {
+			name, target := hpaMetricValue(m, "target")
+			targets[name] = target
+		}
+	}
+	currentMetrics, _, _ := unstructured.NestedSlice(hpa.Object, "status", "currentMetrics")
+	for _, metric := range currentMetrics {
+		if m, ok := metric.(map[string]interface{}); ok {
+			name, value := hpaMetricValue(m, "current")
+			parts = append(parts, fmt.Sprintf("%s %s/%s", name, orUnknown(value), orUnknown(targets[name])))
+			delete(targets, name)
+		}
+	}
+	//the metrics which the HPA could not read yet
+	for _, metric := range specMetrics {
+		if m, ok := metric.(map[string]interface{}); ok {
+			name, _ := hpaMetricValue(m, "target")
+			if target, ok := targets[name]; ok {
+				parts = append(parts, fmt.Sprintf("%s <unknown>/%s", name, orUnknown(target)))
+			}
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// hpaMetricValue returns the name of an autoscaling/v2 metric and its target or current value,
+// field is `target` for the metrics of the spec and `current` for the ones of the status
+func hpaMetricValue(metric map[string]interface{}, field string) (string, string) {
+	metricType := stringValue(metric["type"])
+	source, _ := metric[hpaMetricSources[metricType]].(map[string]interface{})
+	if source == nil {
+		return metricType, ""
+	}
+	name := stringValue(source["name"])
+	if m, ok := source["metric"].(map[string]interface{}); ok {
+		name = stringValue(m["name"])
+	}
+	value, _ := source[field].(map[string]interface{})
+	switch {
+	case value == nil:
+		return name, ""
+	case value["averageUtilization"] != nil:
+		return name, fmt.Sprintf("%v%%", value["averageUtilization"])
+	case value["averageValue"] != nil:
+		return name, stringValue(value["averageValue"])
+	default:
+		return name, stringValue(value["value"])
+	}
+}
+
+func orUnknown(value string) string {
+	if value == "" {
+		return "<unknown>"
+	}
+	return value
+}
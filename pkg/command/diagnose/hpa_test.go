@@ -0,0 +1,78 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestHPASummary(t *testing.T) {
+	cpuTarget := map[string]interface{}{"type": "Resource", "resource": map[string]interface{}{
+		"name": "cpu", "target": map[string]interface{}{"type": "Utilization", "averageUtilization": int64(70)}}}
+	cpuCurrent := map[string]interface{}{"type": "Resource", "resource": map[string]interface{}{
+		"name": "cpu", "current": map[string]interface{}{"averageUtilization": int64(45), "averageValue": "90m"}}}
+	rpsTarget := map[string]interface{}{"type": "Pods", "pods": map[string]interface{}{
+		"metric": map[string]interface{}{"name": "rps"}, "target": map[string]interface{}{"type": "AverageValue", "averageValue": "100"}}}
+
+	tests := []struct {
+		name string
+		hpa  map[string]interface{}
+		want string
+	}{
+		{
+			name: "no metrics and default min",
+			hpa: map[string]interface{}{
+				"spec":   map[string]interface{}{"maxReplicas": int64(5)},
+				"status": map[string]interface{}{"currentReplicas": int64(1), "desiredReplicas": int64(1)},
+			},
+			want: "replicas 1/1 (min 1, max 5)",
+		},
+		{
+			name: "current metric next to its target",
+			hpa: map[string]interface{}{
+				"spec": map[string]interface{}{"minReplicas": int64(2), "maxReplicas": int64(10), "metrics": []interface{}{cpuTarget}},
+				"status": map[string]interface{}{"currentReplicas": int64(2), "desiredReplicas": int64(3),
+					"currentMetrics": []interface{}{cpuCurrent}},
+			},
+			want: "replicas 2/3 (min 2, max 10), cpu 45%/70%",
+		},
+		{
+			name: "metric not read yet",
+			hpa: map[string]interface{}{
+				"spec": map[string]interface{}{"minReplicas": int64(1), "maxReplicas": int64(10), "metrics": []interface{}{cpuTarget, rpsTarget}},
+				"status": map[string]interface{}{"currentReplicas": int64(1), "desiredReplicas": int64(1),
+					"currentMetrics": []interface{}{cpuCurrent}},
+			},
+			want: "replicas 1/1 (min 1, max 10), cpu 45%/70%, rps <unknown>/100",
+		},
+		{
+			name: "metric without source",
+			hpa: map[string]interface{}{
+				"spec": map[string]interface{}{"maxReplicas": int64(3), "metrics": []interface{}{map[string]interface{}{"type": "External"}}},
+			},
+			want: "replicas 0/0 (min 1, max 3), External <unknown>/<unknown>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, hpaSummary(&unstructured.Unstructured{Object: tt.hpa}), tt.want)
+		})
+	}
+}
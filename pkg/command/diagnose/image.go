@@ -0,0 +1,267 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/google/go-containerregistry/pkg/name"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"knative.dev/serving/pkg/deployment"
+
+	. "knative.dev/kn-plugin-diag/pkg/models"
+	. "knative.dev/kn-plugin-diag/pkg/utils"
+)
+
+const (
+	registriesSkippingTagResolvingKey = "registries-skipping-tag-resolving"
+	digestResolutionTimeoutKey        = "digest-resolution-timeout"
+)
+
+var explainImage bool
+
+// imageStep is a step of the resolution of the image of a container of a revision
+type imageStep struct {
+	container string
+	step      string
+	value     string
+	detail    string
+}
+
+// printImageExplanation explains how the images of every revision of the tree were resolved to digests,
+// and compares the digests to the ones run by the pods
+func printImageExplanation(sc *ServingConfiguration) {
+	data, config := sc.loadDeploymentConfig()
+	for _, revision := range findReportNodes(sc.report.Root, "revision") {
+		steps, notes := sc.explainRevisionImages(revision, data, config)
+		fmt.Printf("\nImage digests of revision %s\n", revision.Name)
+		table := NewTable(os.Stdout, []string{"Container", "Step", "Value", "Detail"})
+		table.SetSeperator(false)
+		for _, step := range steps {
+			table.Add([]string{step.container, step.step, step.value, step.detail})
+		}
+		table.Print()
+		for _, note := range notes {
+			fmt.Printf("* %s\n", note)
+		}
+	}
+}
+
+// loadDeploymentConfig returns the data of config-deployment and the parsed configuration, which falls back
+// to the defaults of Knative Serving when the ConfigMap can not be loaded or parsed
+func (sc *ServingConfiguration) loadDeploymentConfig() (map[string]string, *deployment.Config) {
+	data := sc.loadServingConfigMap(deployment.ConfigName)
+	config, err := deployment.NewConfigFromMap(withQueueSidecarImage(data))
+	if err != nil {
+		sc.warn("Invalid configmap %s/%s, the defaults of Knative Serving are used, %v\n", servingNamespace, deployment.ConfigName, err)
+		data = map[string]string{}
+		config, _ = deployment.NewConfigFromMap(withQueueSidecarImage(data))
+	}
+	return data, config
+}
+
+// withQueueSidecarImage sets a placeholder for the image of the queue-proxy when it is missing, e.g. in a dump
+// without config-deployment. It has no default but the parser requires it, and no diagnosis depends on it.
+func withQueueSidecarImage(data map[string]string) map[string]string {
+	if data[deployment.QueueSidecarImageKey] != "" || data[deployment.DeprecatedQueueSidecarImageKey] != "" {
+		return data
+	}
+	withImage := map[string]string{deployment.QueueSidecarImageKey: "queue-proxy"}
+	for k, v := range data {
+		withImage[k] = v
+	}
+	return withImage
+}
+
+// explainRevisionImages follows every container of the revision from the image of the ksvc template to the
+// digest resolved by the revision reconciler, the caching Image and the image run by the pods
+func (sc *ServingConfiguration) explainRevisionImages(revision *ReportNode, data map[string]string, config *deployment.Config) ([]imageStep, []string) {
+	steps := []imageStep{}
+	notes := []string{}
+	c := color.New(color.FgRed).Add(color.Bold)
+	if revision.Object == nil {
+		return steps, append(notes, fmt.Sprintf("Revision %s is not loaded, its images can not be explained", revision.Name))
+	}
+
+	latest := false
+	if sc.report.Root != nil && sc.report.Root.Object != nil {
+		latestCreated, _, _ := unstructured.NestedString(sc.report.Root.Object.Object, "status", "latestCreatedRevisionName")
+		latest = latestCreated == revision.Name
+	}
+	statuses := containerStatusesByName(revision.Object, "status", "containerStatuses")
+	pods := findReportNodes(revision, "pod")
+	images := findReportNodes(revision, "image")
+
+	containers, _, _ := unstructured.NestedSlice(revision.Object.Object, "spec", "containers")
+	for i, container := range containers {
+		ct, ok := container.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		containerName := stringValue(ct["name"])
+		image := stringValue(ct["image"])
+		add := func(step, value, detail string) {
+			steps = append(steps, imageStep{containerName, step, value, detail})
+		}
+
+		//only the latest revision is expected to run the image of the ksvc template
+		if latest {
+			if ksvcImage := ksvcContainerImage(sc.report.Root.Object, containerName, i); ksvcImage != image {
+				add("ksvc", c.Sprintf("%s", ksvcImage), "spec.template differs from the revision, a newer revision is not created yet")
+			} else {
+				add("ksvc", ksvcImage, "spec.template")
+			}
+		}
+
+		digest, resolution := "", ""
+		if _, err := name.NewDigest(image, name.WeakValidation); err == nil {
+			add("revision", image, "already a digest, no resolution needed")
+			digest = image
+		} else if tag, err := name.NewTag(image, name.WeakValidation); err != nil {
+			add("revision", c.Sprintf("%s", image), fmt.Sprintf("not a valid image reference, %v", err))
+			resolution = "invalid"
+		} else if config.RegistriesSkippingTagResolving.Has(tag.Registry.RegistryStr()) {
+			detail := fmt.Sprintf("tag %s, registry %s is in %s %s", tag.TagStr(), tag.Registry.RegistryStr(),
+				deployment.ConfigName, registriesSkippingTagResolvingKey)
+			if _, ok := data[registriesSkippingTagResolvingKey]; !ok {
+				detail += " by default"
+			}
+			add("revision", image, detail)
+			resolution = "skipped"
+		} else {
+			add("revision", image, fmt.Sprintf("tag %s of registry %s, resolved to a digest when the revision is created", tag.TagStr(), tag.Registry.RegistryStr()))
+		}
+
+		status, resolved := statuses[containerName]
+		switch {
+		case digest != "" || resolution == "invalid":
+		case resolved && stringValue(status["imageDigest"]) != "":
+			digest = stringValue(status["imageDigest"])
+			add("resolved", digest, "status.containerStatuses of the revision")
+		case resolved || resolution == "skipped":
+			add("resolved", "<none>", "the tag is not resolved, the pods pull it and may run different images over time")
+		default:
+			value, detail := resolutionFailure(revision.Object, data, config)
+			add("resolved", c.Sprintf("%s", value), detail)
+			notes = append(notes, fmt.Sprintf("The image of container %s is not resolved: %s", containerName, detail))
+		}
+
+		if cache := cachingImageOf(images, revision.Name, containerName); cache != nil && cache.Object != nil {
+			cacheImage, _, _ := unstructured.NestedString(cache.Object.Object, "spec", "image")
+			detail := "caching Image " + cache.Name
+			if ready := conditionOf(cache.Object, "Ready"); ready != nil {
+				detail += fmt.Sprintf(", Ready %s %s", stringValue(ready["status"]), stringValue(ready["reason"]))
+			} else {
+				detail += ", no status, it is only reconciled when a caching extension is installed"
+			}
+			add("cached", cacheImage, detail)
+		}
+
+		for _, pod := range pods {
+			podStatus, ok := containerStatusesByName(pod.Object, "status", "containerStatuses")[containerName]
+			if !ok {
+				add("pod", "<not started>", pod.Name)
+				continue
+			}
+			imageID := stringValue(podStatus["imageID"])
+			switch {
+			case imageID == "":
+				add("pod", "<not pulled>", pod.Name)
+			case digest == "" || !strings.Contains(imageID, "@") || digestOf(imageID) == digestOf(digest):
+				add("pod", imageID, pod.Name)
+			default:
+				add("pod", c.Sprintf("%s", imageID), pod.Name+", differs from the resolved digest")
+				notes = append(notes, fmt.Sprintf("Pod %s runs %s while container %s resolved to %s", pod.Name, digestOf(imageID), containerName, digestOf(digest)))
+			}
+		}
+		if resolution == "skipped" {
+			notes = append(notes, fmt.Sprintf("The tag of container %s is not resolved, pushing the tag again changes the image of the new pods only", containerName))
+		}
+	}
+	return steps, notes
+}
+
+// resolutionFailure explains why the revision has no container status yet: either the digest resolution is still
+// running, or it failed and the reason is in the ContainerHealthy condition
+func resolutionFailure(revision *unstructured.Unstructured, data map[string]string, config *deployment.Config) (string, string) {
+	if healthy := conditionOf(revision, "ContainerHealthy"); healthy != nil && stringValue(healthy["status"]) == "False" &&
+		stringValue(healthy["reason"]) == "ContainerMissing" {
+		return "failed", stringValue(healthy["message"])
+	}
+	timeout := config.DigestResolutionTimeout.String()
+	if _, ok := data[digestResolutionTimeoutKey]; ok {
+		timeout += " from " + deployment.ConfigName + " " + digestResolutionTimeoutKey
+	}
+	if available := conditionOf(revision, "ResourcesAvailable"); available != nil && stringValue(available["reason"]) == "ResolvingDigests" {
+		return "resolving", "the controller is resolving the tag against the registry, it gives up after " + timeout
+	}
+	return "pending", "no digest in the status of the revision, the controller times out after " + timeout
+}
+
+// containerStatusesByName returns the container statuses found at the fields of the object indexed by container name
+func containerStatusesByName(object *unstructured.Unstructured, fields ...string) map[string]map[string]interface{} {
+	statuses := make(map[string]map[string]interface{})
+	if object == nil {
+		return statuses
+	}
+	list, _, _ := unstructured.NestedSlice(object.Object, fields...)
+	for _, status := range list {
+		if s, ok := status.(map[string]interface{}); ok {
+			statuses[stringValue(s["name"])] = s
+		}
+	}
+	return statuses
+}
+
+// ksvcContainerImage returns the image of the container of the ksvc template, matched by name and else by index
+// since the name of a single container is defaulted on the revision only
+func ksvcContainerImage(ksvc *unstructured.Unstructured, containerName string, index int) string {
+	containers, _, _ := unstructured.NestedSlice(ksvc.Object, "spec", "template", "spec", "containers")
+	for _, container := range containers {
+		if ct, ok := container.(map[string]interface{}); ok && stringValue(ct["name"]) == containerName {
+			return stringValue(ct["image"])
+		}
+	}
+	if index < len(containers) {
+		if ct, ok := containers[index].(map[string]interface{}); ok {
+			return stringValue(ct["image"])
+		}
+	}
+	return ""
+}
+
+// cachingImageOf returns the caching Image of a container, named after the revision and the container
+func cachingImageOf(images []*ReportNode, revisionName, containerName string) *ReportNode {
+	for _, image := range images {
+		if image.Name == revisionName+"-cache-"+containerName {
+			return image
+		}
+	}
+	return nil
+}
+
+// digestOf returns the digest of an image reference or of a container imageID, e.g. sha256:abc of
+// docker-pullable://ghcr.io/knative/helloworld-go@sha256:abc
+func digestOf(image string) string {
+	if i := strings.LastIndex(image, "@"); i >= 0 {
+		return image[i+1:]
+	}
+	return image
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"knative.dev/serving/pkg/deployment"
+
+	. "knative.dev/kn-plugin-diag/pkg/models"
+)
+
+func TestExplainRevisionImages(t *testing.T) {
+	digestA := "sha256:" + strings.Repeat("a", 64)
+	digestB := "sha256:" + strings.Repeat("b", 64)
+	revision := func(image string, status map[string]interface{}, children ...*ReportNode) *ReportNode {
+		object := &unstructured.Unstructured{Object: map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "hello-00001", "namespace": "demo"},
+			"spec": map[string]interface{}{"containers": []interface{}{
+				map[string]interface{}{"name": "user-container", "image": image},
+			}},
+		}}
+		if status != nil {
+			object.Object["status"] = status
+		}
+		return &ReportNode{Type: "revision", Name: "hello-00001", Object: object, Children: children}
+	}
+	resolvedStatus := map[string]interface{}{"containerStatuses": []interface{}{
+		map[string]interface{}{"name": "user-container", "imageDigest": "ghcr.io/knative/hello@" + digestA},
+	}}
+	conditions := func(conditions ...interface{}) map[string]interface{} {
+		return map[string]interface{}{"conditions": conditions}
+	}
+	pod := func(imageID string) *ReportNode {
+		object := &unstructured.Unstructured{Object: map[string]interface{}{
+			"status": map[string]interface{}{"containerStatuses": []interface{}{
+				map[string]interface{}{"name": "user-container", "imageID": imageID},
+			}},
+		}}
+		return &ReportNode{Type: "pod", Name: "hello-00001-deployment-abc-xyz", Object: object}
+	}
+	cachingImage := func(status map[string]interface{}) *ReportNode {
+		object := &unstructured.Unstructured{Object: map[string]interface{}{
+			"spec": map[string]interface{}{"image": "ghcr.io/knative/hello@" + digestA},
+		}}
+		if status != nil {
+			object.Object["status"] = status
+		}
+		return &ReportNode{Type: "image", Name: "hello-00001-cache-user-container", Object: object}
+	}
+
+	tests := []struct {
+		name      string
+		revision  *ReportNode
+		data      map[string]string
+		wantSteps []imageStep
+		wantNotes []string
+	}{
+		{
+			name:     "digest",
+			revision: revision("ghcr.io/knative/hello@"+digestA, nil, pod("docker-pullable://ghcr.io/knative/hello@"+digestA)),
+			wantSteps: []imageStep{
+				{"user-container", "revision", "ghcr.io/knative/hello@" + digestA, "already a digest, no resolution needed"},
+				{"user-container", "pod", "docker-pullable://ghcr.io/knative/hello@" + digestA, "hello-00001-deployment-abc-xyz"},
+			},
+			wantNotes: []string{},
+		},
+		{
+			name:     "tag resolved to a digest",
+			revision: revision("ghcr.io/knative/hello:v1", resolvedStatus),
+			wantSteps: []imageStep{
+				{"user-container", "revision", "ghcr.io/knative/hello:v1", "tag v1 of registry ghcr.io, resolved to a digest when the revision is created"},
+				{"user-container", "resolved", "ghcr.io/knative/hello@" + digestA, "status.containerStatuses of the revision"},
+			},
+			wantNotes: []string{},
+		},
+		{
+			name:     "registry skipping the tag resolution by default",
+			revision: revision("ko.local/hello:v1", map[string]interface{}{"containerStatuses": []interface{}{map[string]interface{}{"name": "user-container"}}}),
+			wantSteps: []imageStep{
+				{"user-container", "revision", "ko.local/hello:v1", "tag v1, registry ko.local is in config-deployment registries-skipping-tag-resolving by default"},
+				{"user-container", "resolved", "<none>", "the tag is not resolved, the pods pull it and may run different images over time"},
+			},
+			wantNotes: []string{"The tag of container user-container is not resolved, pushing the tag again changes the image of the new pods only"},
+		},
+		{
+			name:     "registry skipping the tag resolution in config-deployment",
+			revision: revision("registry.corp/hello:v1", nil),
+			data:     map[string]string{"registries-skipping-tag-resolving": "registry.corp"},
+			wantSteps: []imageStep{
+				{"user-container", "revision", "registry.corp/hello:v1", "tag v1, registry registry.corp is in config-deployment registries-skipping-tag-resolving"},
+				{"user-container", "resolved", "<none>", "the tag is not resolved, the pods pull it and may run different images over time"},
+			},
+			wantNotes: []string{"The tag of container user-container is not resolved, pushing the tag again changes the image of the new pods only"},
+		},
+		{
+			name: "resolving",
+			revision: revision("ghcr.io/knative/hello:v1", conditions(
+				map[string]interface{}{"type": "ResourcesAvailable", "status": "Unknown", "reason": "ResolvingDigests"})),
+			wantSteps: []imageStep{
+				{"user-container", "revision", "ghcr.io/knative/hello:v1", "tag v1 of registry ghcr.io, resolved to a digest when the revision is created"},
+				{"user-container", "resolved", "resolving", "the controller is resolving the tag against the registry, it gives up after 10s"},
+			},
+			wantNotes: []string{"The image of container user-container is not resolved: the controller is resolving the tag against the registry, it gives up after 10s"},
+		},
+		{
+			name: "failed",
+			revision: revision("ghcr.io/knative/hello:v1", conditions(
+				map[string]interface{}{"type": "ContainerHealthy", "status": "False", "reason": "ContainerMissing", "message": "Unable to fetch image"})),
+			wantSteps: []imageStep{
+				{"user-container", "revision", "ghcr.io/knative/hello:v1", "tag v1 of registry ghcr.io, resolved to a digest when the revision is created"},
+				{"user-container", "resolved", "failed", "Unable to fetch image"},
+			},
+			wantNotes: []string{"The image of container user-container is not resolved: Unable to fetch image"},
+		},
+		{
+			name:     "pending with the timeout of config-deployment",
+			revision: revision("ghcr.io/knative/hello:v1", nil),
+			data:     map[string]string{"digest-resolution-timeout": "20s"},
+			wantSteps: []imageStep{
+				{"user-container", "revision", "ghcr.io/knative/hello:v1", "tag v1 of registry ghcr.io, resolved to a digest when the revision is created"},
+				{"user-container", "resolved", "pending", "no digest in the status of the revision, the controller times out after 20s from config-deployment digest-resolution-timeout"},
+			},
+			wantNotes: []string{"The image of container user-container is not resolved: no digest in the status of the revision, the controller times out after 20s from config-deployment digest-resolution-timeout"},
+		},
+		{
+			name: "caching Image with status",
+			revision: revision("ghcr.io/knative/hello@"+digestA, nil,
+				cachingImage(conditions(map[string]interface{}{"type": "Ready", "status": "True", "reason": "Cached"}))),
+			wantSteps: []imageStep{
+				{"user-container", "revision", "ghcr.io/knative/hello@" + digestA, "already a digest, no resolution needed"},
+				{"user-container", "cached", "ghcr.io/knative/hello@" + digestA, "caching Image hello-00001-cache-user-container, Ready True Cached"},
+			},
+			wantNotes: []string{},
+		},
+		{
+			name:     "caching Image without status",
+			revision: revision("ghcr.io/knative/hello@"+digestA, nil, cachingImage(nil)),
+			wantSteps: []imageStep{
+				{"user-container", "revision", "ghcr.io/knative/hello@" + digestA, "already a digest, no resolution needed"},
+				{"user-container", "cached", "ghcr.io/knative/hello@" + digestA, "caching Image hello-00001-cache-user-container, no status, it is only reconciled when a caching extension is installed"},
+			},
+			wantNotes: []string{},
+		},
+		{
+			name:     "pod running another digest",
+			revision: revision("ghcr.io/knative/hello:v1", resolvedStatus, pod("docker-pullable://ghcr.io/knative/hello@"+digestB), pod("")),
+			wantSteps: []imageStep{
+				{"user-container", "revision", "ghcr.io/knative/hello:v1", "tag v1 of registry ghcr.io, resolved to a digest when the revision is created"},
+				{"user-container", "resolved", "ghcr.io/knative/hello@" + digestA, "status.containerStatuses of the revision"},
+				{"user-container", "pod", "docker-pullable://ghcr.io/knative/hello@" + digestB, "hello-00001-deployment-abc-xyz, differs from the resolved digest"},
+				{"user-container", "pod", "<not pulled>", "hello-00001-deployment-abc-xyz"},
+			},
+			wantNotes: []string{"Pod hello-00001-deployment-abc-xyz runs " + digestB + " while container user-container resolved to " + digestA},
+		},
+		{
+			name:      "revision not loaded",
+			revision:  &ReportNode{Type: "revision", Name: "hello-00001"},
+			wantSteps: []imageStep{},
+			wantNotes: []string{"Revision hello-00001 is not loaded, its images can not be explained"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := deployment.NewConfigFromConfigMap(&corev1.ConfigMap{Data: withQueueSidecarImage(tt.data)})
+			assert.NilError(t, err)
+			sc := &ServingConfiguration{ksvcName: "hello", Namespace: "demo", report: &Report{Root: &ReportNode{Type: "ksvc", Name: "hello"}}}
+
+			steps, notes := sc.explainRevisionImages(tt.revision, tt.data, config)
+			assert.DeepEqual(t, steps, tt.wantSteps, cmp.AllowUnexported(imageStep{}))
+			assert.DeepEqual(t, notes, tt.wantNotes)
+		})
+	}
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+
+	. "knative.dev/kn-plugin-diag/pkg/utils"
+)
+
+// resolveNamespace returns the namespace to use like kn and kubectl do: the namespace flag when set,
+// then the namespace of the current kubeconfig context, then the one of the kn config when run as a kn plugin,
+// and finally "default"
+func resolveNamespace(cmd *cobra.Command, flagValue string, p *ConnectionConfig) string {
+	if cmd.Flags().Changed("namespace") {
+		return flagValue
+	}
+	if p != nil {
+		if namespace := p.ContextNamespace(); namespace != "" {
+			return namespace
+		}
+	}
+	if IsKnPlugin() {
+		if namespace := LoadKnConfig().Namespace; namespace != "" {
+			return namespace
+		}
+	}
+	return "default"
+}
+
+// findServiceNamespace looks up a knative service by name across all the namespaces
+func findServiceNamespace(ctx context.Context, dynClient dynamic.Interface, ksvcName string) (string, error) {
+	ksvcList, err := dynClient.Resource(ksvcGVR).List(ctx, metav1.ListOptions{FieldSelector: "metadata.name=" + ksvcName})
+	if err != nil {
+		return "", fmt.Errorf("Failed to list the knative services of all namespaces, %v", err)
+	}
+	namespaces := []string{}
+	for _, ksvc := range ksvcList.Items {
+		//the field selector may not be honored, e.g. offline
+		if ksvc.GetName() == ksvcName {
+			namespaces = append(namespaces, ksvc.GetNamespace())
+		}
+	}
+	switch len(namespaces) {
+	case 0:
+		return "", fmt.Errorf("No knative service %s found in any namespace", ksvcName)
+	case 1:
+		return namespaces[0], nil
+	default:
+		return "", fmt.Errorf("knative service %s exists in several namespaces: %s, please choose one with -n", ksvcName, strings.Join(namespaces, ", "))
+	}
+}
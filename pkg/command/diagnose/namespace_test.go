@@ -0,0 +1,122 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"gotest.tools/v3/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	. "knative.dev/kn-plugin-diag/pkg/utils"
+)
+
+func TestResolveNamespace(t *testing.T) {
+	kubeConfig := filepath.Join(t.TempDir(), "kubeconfig")
+	assert.NilError(t, os.WriteFile(kubeConfig, []byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: dev
+  cluster:
+    server: https://dev.example.com
+contexts:
+- name: dev
+  context:
+    cluster: dev
+    namespace: demo
+- name: prod
+  context:
+    cluster: dev
+current-context: dev
+`), 0600))
+	configHome := t.TempDir()
+	assert.NilError(t, os.MkdirAll(filepath.Join(configHome, "kn"), 0755))
+	assert.NilError(t, os.WriteFile(filepath.Join(configHome, "kn", "config.yaml"), []byte("namespace: kn-demo\n"), 0600))
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+
+	tests := []struct {
+		name     string
+		args     []string
+		context  string
+		knPlugin bool
+		want     string
+	}{
+		{name: "namespace flag", args: []string{"-n", "flag-demo"}, want: "flag-demo"},
+		{name: "empty namespace flag", args: []string{"-n", ""}, want: ""},
+		{name: "kubeconfig context", want: "demo"},
+		{name: "kubeconfig context before the kn config", knPlugin: true, want: "demo"},
+		{name: "kn config", context: "prod", knPlugin: true, want: "kn-demo"},
+		{name: "kn config only read by the kn plugin", context: "prod", want: "default"},
+	}
+	args := os.Args
+	defer func() { os.Args = args }()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Args = []string{"kn-diag-test"}
+			if !tt.knPlugin {
+				os.Args = []string{"diag-test"}
+			}
+			var namespace string
+			cmd := &cobra.Command{}
+			cmd.Flags().StringVarP(&namespace, "namespace", "n", "", "")
+			assert.NilError(t, cmd.Flags().Parse(tt.args))
+			p := &ConnectionConfig{KubeCfgPath: kubeConfig}
+			p.Overrides.CurrentContext = tt.context
+
+			assert.Equal(t, resolveNamespace(cmd, namespace, p), tt.want)
+		})
+	}
+}
+
+func TestFindServiceNamespace(t *testing.T) {
+	ksvc := func(namespace, name string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion("serving.knative.dev/v1")
+		obj.SetKind("Service")
+		obj.SetNamespace(namespace)
+		obj.SetName(name)
+		return obj
+	}
+	tests := []struct {
+		name    string
+		objects []*unstructured.Unstructured
+		want    string
+		wantErr string
+	}{
+		{name: "not found", objects: []*unstructured.Unstructured{ksvc("demo", "bye")}, wantErr: "No knative service hello found in any namespace"},
+		{name: "single namespace", objects: []*unstructured.Unstructured{ksvc("demo", "hello"), ksvc("other", "bye")}, want: "demo"},
+		{name: "several namespaces", objects: []*unstructured.Unstructured{ksvc("demo", "hello"), ksvc("other", "hello")},
+			wantErr: "knative service hello exists in several namespaces: demo, other, please choose one with -n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := newOfflineDynamicClient(tt.objects, "")
+			assert.NilError(t, err)
+			namespace, err := findServiceNamespace(context.Background(), client, "hello")
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, namespace, tt.want)
+		})
+	}
+}
@@ -0,0 +1,223 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/fake"
+	"sigs.k8s.io/yaml"
+)
+
+// knownResources maps the kinds which can show up in the tree, in a bundle or in a
+// kubectl dump to their resource name. Some of them can not be guessed from the kind.
+var knownResources = map[schema.GroupKind]string{
+	{Group: "serving.knative.dev", Kind: "Service"}:                       "services",
+	{Group: "serving.knative.dev", Kind: "Configuration"}:                 "configurations",
+	{Group: "serving.knative.dev", Kind: "Route"}:                         "routes",
+	{Group: "serving.knative.dev", Kind: "Revision"}:                      "revisions",
+	{Group: "caching.internal.knative.dev", Kind: "Image"}:                "images",
+	{Group: "autoscaling.internal.knative.dev", Kind: "PodAutoscaler"}:    "podautoscalers",
+	{Group: "autoscaling.internal.knative.dev", Kind: "Metric"}:           "metrics",
+	{Group: "networking.internal.knative.dev", Kind: "ServerlessService"}: "serverlessservices",
+	{Group: "networking.internal.knative.dev", Kind: "Ingress"}:           "ingresses",
+	{Group: "networking.internal.knative.dev", Kind: "Certificate"}:       "certificates",
+	{Group: "apps", Kind: "Deployment"}:                                   "deployments",
+	{Group: "apps", Kind: "ReplicaSet"}:                                   "replicasets",
+	{Group: "", Kind: "Pod"}:                                              "pods",
+	{Group: "", Kind: "Service"}:                                          "services",
+	{Group: "", Kind: "Endpoints"}:                                        "endpoints",
+	{Group: "", Kind: "Event"}:                                            "events",
+	{Group: "", Kind: "ConfigMap"}:                                        "configmaps",
+	{Group: "", Kind: "Namespace"}:                                        "namespaces",
+	{Group: "", Kind: "ResourceQuota"}:                                    "resourcequotas",
+	{Group: "", Kind: "LimitRange"}:                                       "limitranges",
+	{Group: "autoscaling", Kind: "HorizontalPodAutoscaler"}:               "horizontalpodautoscalers",
+}
+
+// loadBundle reads the objects and the manifest of a bundle written by writeBundle
+func loadBundle(fileName string) ([]*unstructured.Unstructured, *BundleManifest, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to open bundle %s, %v", fileName, err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to read bundle %s, %v", fileName, err)
+	}
+	tr := tar.NewReader(gz)
+
+	objects := []*unstructured.Unstructured{}
+	manifest := &BundleManifest{}
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to read bundle %s, %v", fileName, err)
+		}
+		if header.Typeflag != tar.TypeReg || !isManifestFile(header.Name) {
+			continue
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to read %s from bundle %s, %v", header.Name, fileName, err)
+		}
+		if header.Name == bundleManifestFile {
+			if err := yaml.Unmarshal(content, manifest); err != nil {
+				return nil, nil, fmt.Errorf("Invalid manifest in bundle %s, %v", fileName, err)
+			}
+			continue
+		}
+		decoded, err := decodeObjects(content)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to decode %s from bundle %s, %v", header.Name, fileName, err)
+		}
+		objects = append(objects, decoded...)
+	}
+	return objects, manifest, nil
+}
+
+// loadDir reads every YAML or JSON file below dir, e.g. the output of `kubectl get -o yaml`
+func loadDir(dir string) ([]*unstructured.Unstructured, error) {
+	objects := []*unstructured.Unstructured{}
+	err := filepath.WalkDir(dir, func(fileName string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !isManifestFile(fileName) || filepath.Base(fileName) == bundleManifestFile {
+			return nil
+		}
+		content, err := os.ReadFile(fileName)
+		if err != nil {
+			return err
+		}
+		decoded, err := decodeObjects(content)
+		if err != nil {
+			return fmt.Errorf("Failed to decode %s, %v", fileName, err)
+		}
+		objects = append(objects, decoded...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load objects from %s, %v", dir, err)
+	}
+	return objects, nil
+}
+
+func isManifestFile(fileName string) bool {
+	switch strings.ToLower(path.Ext(fileName)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// decodeObjects decodes a multi-document YAML or JSON content, lists are flattened into their items
+func decodeObjects(content []byte) ([]*unstructured.Unstructured, error) {
+	objects := []*unstructured.Unstructured{}
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(content), 4096)
+	for {
+		raw := runtime.RawExtension{}
+		if err := decoder.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		raw.Raw = bytes.TrimSpace(raw.Raw)
+		if len(raw.Raw) == 0 || bytes.Equal(raw.Raw, []byte("null")) {
+			continue
+		}
+		//decode with the unstructured scheme to keep the integers as int64
+		obj, _, err := unstructured.UnstructuredJSONScheme.Decode(raw.Raw, nil, nil)
+		if runtime.IsMissingKind(err) || runtime.IsMissingVersion(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch u := obj.(type) {
+		case *unstructured.UnstructuredList:
+			for i := range u.Items {
+				objects = append(objects, &u.Items[i])
+			}
+		case *unstructured.Unstructured:
+			if u.GetName() != "" {
+				objects = append(objects, u)
+			}
+		}
+	}
+	return objects, nil
+}
+
+// newOfflineDynamicClient returns a dynamic client served by an in-memory object tracker
+// holding objects. The objects without namespace are put in the defaultNamespace.
+func newOfflineDynamicClient(objects []*unstructured.Unstructured, defaultNamespace string) (dynamic.Interface, error) {
+	listKinds := make(map[schema.GroupVersionResource]string)
+	for gk, resource := range knownResources {
+		for _, version := range []string{"v1", "v1alpha1", "v2"} {
+			listKinds[schema.GroupVersionResource{Group: gk.Group, Version: version, Resource: resource}] = gk.Kind + "List"
+		}
+	}
+
+	gvrs := make([]schema.GroupVersionResource, len(objects))
+	for i, obj := range objects {
+		gvk := obj.GroupVersionKind()
+		gvr := gvk.GroupVersion().WithResource(knownResources[gvk.GroupKind()])
+		if gvr.Resource == "" {
+			gvr, _ = meta.UnsafeGuessKindToResource(gvk)
+		}
+		gvrs[i] = gvr
+		listKinds[gvr] = gvk.Kind + "List"
+	}
+
+	client := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds)
+	//the same object may be dumped into several files
+	for i, obj := range objects {
+		namespace := obj.GetNamespace()
+		if namespace == "" && obj.GetKind() != "Namespace" {
+			namespace = defaultNamespace
+			obj.SetNamespace(namespace)
+		}
+		err := client.Tracker().Create(gvrs[i], obj, namespace)
+		if err != nil && !apierrors.IsAlreadyExists(err) {
+			return nil, fmt.Errorf("Failed to load %s %s, %v", obj.GetKind(), obj.GetName(), err)
+		}
+	}
+	return client, nil
+}
@@ -0,0 +1,230 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestDecodeObjects(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "multi-document YAML with empty documents",
+			content: `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config-domain
+---
+# a comment only
+---
+apiVersion: serving.knative.dev/v1
+kind: Service
+metadata:
+  name: hello
+  generation: 2
+`,
+			want: []string{"ConfigMap/config-domain", "Service/hello"},
+		},
+		{
+			name: "List kind flattened into its items",
+			content: `apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: Pod
+  metadata:
+    name: hello-00001-deployment-abc-xyz
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: hello-00001-deployment
+`,
+			want: []string{"Pod/hello-00001-deployment-abc-xyz", "Deployment/hello-00001-deployment"},
+		},
+		{
+			name:    "JSON object",
+			content: `{"apiVersion": "v1", "kind": "Namespace", "metadata": {"name": "demo"}}`,
+			want:    []string{"Namespace/demo"},
+		},
+		{
+			name: "documents without kind or name skipped",
+			content: `foo: bar
+---
+apiVersion: v1
+kind: ConfigMap
+metadata: {}
+`,
+			want: []string{},
+		},
+		{
+			name:    "invalid document",
+			content: "apiVersion: v1\nkind: [ConfigMap\n",
+			wantErr: "error converting YAML to JSON",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects, err := decodeObjects([]byte(tt.content))
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NilError(t, err)
+			names := []string{}
+			for _, obj := range objects {
+				names = append(names, obj.GetKind()+"/"+obj.GetName())
+			}
+			assert.DeepEqual(t, names, tt.want)
+		})
+	}
+}
+
+func TestDecodeObjectsKeepsIntegers(t *testing.T) {
+	objects, err := decodeObjects([]byte("apiVersion: v1\nkind: Pod\nmetadata:\n  name: hello\nspec:\n  priority: 10\n"))
+	assert.NilError(t, err)
+	priority, ok, err := unstructured.NestedInt64(objects[0].Object, "spec", "priority")
+	assert.NilError(t, err)
+	assert.Assert(t, ok)
+	assert.Equal(t, priority, int64(10))
+}
+
+func TestNewOfflineDynamicClient(t *testing.T) {
+	object := func(apiVersion, kind, namespace, name string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion(apiVersion)
+		obj.SetKind(kind)
+		obj.SetNamespace(namespace)
+		obj.SetName(name)
+		return obj
+	}
+	objects := []*unstructured.Unstructured{
+		object("serving.knative.dev/v1", "Service", "demo", "hello"),
+		object("autoscaling.internal.knative.dev/v1alpha1", "PodAutoscaler", "", "hello-00001"),
+		object("v1", "Endpoints", "demo", "hello-00001"),
+		object("v1", "Namespace", "", "demo"),
+		object("example.dev/v1", "Widget", "", "hello"),
+		//the same object dumped twice
+		object("serving.knative.dev/v1", "Service", "demo", "hello"),
+	}
+	client, err := newOfflineDynamicClient(objects, "demo")
+	assert.NilError(t, err)
+
+	tests := []struct {
+		name      string
+		gvr       schema.GroupVersionResource
+		namespace string
+		object    string
+	}{
+		{"known resource", schema.GroupVersionResource{Group: "serving.knative.dev", Version: "v1", Resource: "services"}, "demo", "hello"},
+		{"default namespace", schema.GroupVersionResource{Group: "autoscaling.internal.knative.dev", Version: "v1alpha1", Resource: "podautoscalers"}, "demo", "hello-00001"},
+		{"resource which can not be guessed", schema.GroupVersionResource{Version: "v1", Resource: "endpoints"}, "demo", "hello-00001"},
+		{"cluster scoped namespace", schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}, "", "demo"},
+		{"guessed resource", schema.GroupVersionResource{Group: "example.dev", Version: "v1", Resource: "widgets"}, "demo", "hello"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj, err := client.Resource(tt.gvr).Namespace(tt.namespace).Get(context.Background(), tt.object, metav1.GetOptions{})
+			assert.NilError(t, err)
+			assert.Equal(t, obj.GetName(), tt.object)
+			list, err := client.Resource(tt.gvr).Namespace(tt.namespace).List(context.Background(), metav1.ListOptions{})
+			assert.NilError(t, err)
+			assert.Equal(t, len(list.Items), 1)
+		})
+	}
+
+	//the resources of the tree which are not in the bundle can still be listed
+	list, err := client.Resource(schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "replicasets"}).Namespace("demo").List(context.Background(), metav1.ListOptions{})
+	assert.NilError(t, err)
+	assert.Equal(t, len(list.Items), 0)
+}
+
+func TestLoadBundle(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	bw, err := newBundleWriter(fileName)
+	assert.NilError(t, err)
+	bw.manifest.Service = "hello"
+	bw.manifest.Namespace = "demo"
+	objects := map[string]map[string]interface{}{
+		"objects/ksvc/hello.yaml": {
+			"apiVersion": "serving.knative.dev/v1",
+			"kind":       "Service",
+			"metadata":   map[string]interface{}{"name": "hello", "namespace": "demo", "generation": int64(1)},
+			"status": map[string]interface{}{
+				"observedGeneration":        int64(1),
+				"latestCreatedRevisionName": "hello-00001",
+				"conditions": []interface{}{
+					map[string]interface{}{"type": "Ready", "status": "False", "reason": "RevisionFailed"},
+				},
+			},
+		},
+		"objects/configuration/hello.yaml": {
+			"apiVersion": "serving.knative.dev/v1",
+			"kind":       "Configuration",
+			"metadata":   map[string]interface{}{"name": "hello", "namespace": "demo"},
+			"status":     map[string]interface{}{"latestCreatedRevisionName": "hello-00001"},
+		},
+		"objects/revision/hello-00001.yaml": {
+			"apiVersion": "serving.knative.dev/v1",
+			"kind":       "Revision",
+			"metadata":   map[string]interface{}{"name": "hello-00001", "namespace": "demo"},
+			"status": map[string]interface{}{
+				"conditions": []interface{}{
+					map[string]interface{}{"type": "Ready", "status": "False", "reason": "ContainerMissing"},
+				},
+			},
+		},
+	}
+	for name, obj := range objects {
+		assert.NilError(t, bw.addYAML(name, obj))
+	}
+	assert.NilError(t, bw.addFile("logs/hello-00001-deployment-abc-xyz/user-container.log", []byte("started\n")))
+	assert.NilError(t, bw.close())
+
+	loaded, manifest, err := loadBundle(fileName)
+	assert.NilError(t, err)
+	assert.Equal(t, len(loaded), 3)
+	assert.Equal(t, manifest.Service, "hello")
+	assert.Equal(t, manifest.Namespace, "demo")
+	assert.Equal(t, len(manifest.Files), 4)
+
+	client, err := newOfflineDynamicClient(loaded, manifest.Namespace)
+	assert.NilError(t, err)
+	sc, err := newServingConfigurationForClient(manifest.Service, manifest.Namespace, client)
+	assert.NilError(t, err)
+	assert.Equal(t, sc.report.Root.Name, "hello")
+	revisions := findReportNodes(sc.report.Root, "revision")
+	assert.Equal(t, len(revisions), 1)
+	assert.Equal(t, revisions[0].Name, "hello-00001")
+	assert.Assert(t, sc.report.RootCause != nil)
+	assert.Equal(t, sc.report.RootCause.Name, "hello-00001")
+
+	_, _, err = loadBundle(filepath.Join(t.TempDir(), "missing.tar.gz"))
+	assert.ErrorContains(t, err, "Failed to open bundle")
+}
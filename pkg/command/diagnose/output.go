@@ -0,0 +1,285 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/client-go/util/jsonpath"
+
+	. "knative.dev/kn-plugin-diag/pkg/models"
+	. "knative.dev/kn-plugin-diag/pkg/utils"
+)
+
+const customColumnsPrefix = "custom-columns="
+
+var (
+	// output selects the columns of the default view: "", "wide" or "custom-columns=[TYPE:]HEADER:JSONPATH,..."
+	output string
+
+	wideHeaders = []string{"Age", "Ready", "Node", "Image Digest"}
+
+	// nodeTypes maps the kinds of the objects of the tree to their type in the tree
+	nodeTypes = map[schema.GroupKind]string{
+		{Group: "serving.knative.dev", Kind: "Service"}:                       "ksvc",
+		{Group: "serving.knative.dev", Kind: "Configuration"}:                 "configuration",
+		{Group: "serving.knative.dev", Kind: "Route"}:                         "route",
+		{Group: "serving.knative.dev", Kind: "Revision"}:                      "revision",
+		{Group: "caching.internal.knative.dev", Kind: "Image"}:                "image",
+		{Group: "autoscaling.internal.knative.dev", Kind: "PodAutoscaler"}:    "kpa",
+		{Group: "autoscaling.internal.knative.dev", Kind: "Metric"}:           "metric",
+		{Group: "networking.internal.knative.dev", Kind: "ServerlessService"}: "sks",
+		{Group: "networking.internal.knative.dev", Kind: "Ingress"}:           "kingress",
+		{Group: "apps", Kind: "Deployment"}:                                   "deployment",
+		{Group: "apps", Kind: "ReplicaSet"}:                                   "replicaset",
+		{Group: "", Kind: "Pod"}:                                              "pod",
+		{Group: "autoscaling", Kind: "HorizontalPodAutoscaler"}:               "hpa",
+	}
+)
+
+// outputFormat is the parsed --output flag
+type outputFormat struct {
+	wide    bool
+	columns []customColumn
+}
+
+// customColumn is a column of -o custom-columns. Its JSONPath without type is evaluated on the object of every
+// node of the tree, the ones with a type prefix only on the nodes of that type.
+type customColumn struct {
+	header  string
+	parsers map[string]*jsonpath.JSONPath
+}
+
+func parseOutputFormat(output string) (*outputFormat, error) {
+	switch {
+	case output == "":
+		return &outputFormat{}, nil
+	case output == "wide":
+		return &outputFormat{wide: true}, nil
+	case strings.HasPrefix(output, customColumnsPrefix):
+		format := &outputFormat{}
+		indexes := make(map[string]int)
+		for _, spec := range strings.Split(strings.TrimPrefix(output, customColumnsPrefix), ",") {
+			nodeType, header, template, err := parseCustomColumn(spec)
+			if err != nil {
+				return nil, err
+			}
+			if header == "" || template == "" {
+				return nil, fmt.Errorf("Invalid custom column %q, expected [TYPE:]HEADER:JSONPATH", spec)
+			}
+			if !strings.HasPrefix(template, "{") {
+				template = "{" + template + "}"
+			}
+			parser := jsonpath.New(header).AllowMissingKeys(true)
+			if err := parser.Parse(template); err != nil {
+				return nil, fmt.Errorf("Invalid custom column %q, %v", spec, err)
+			}
+			//the columns of several types share the header
+			i, ok := indexes[header]
+			if !ok {
+				i = len(format.columns)
+				indexes[header] = i
+				format.columns = append(format.columns, customColumn{header: header, parsers: map[string]*jsonpath.JSONPath{}})
+			}
+			if _, ok := format.columns[i].parsers[nodeType]; ok {
+				return nil, fmt.Errorf("Invalid custom column %q, the column %s is already defined for this type", spec, header)
+			}
+			format.columns[i].parsers[nodeType] = parser
+		}
+		return format, nil
+	default:
+		return nil, fmt.Errorf("Unsupported output %q, supported values: wide, custom-columns=[TYPE:]HEADER:JSONPATH,...", output)
+	}
+}
+
+// parseCustomColumn splits a custom column into its node type, empty for all the types, its header and its
+// JSONPath, which may contain colons too
+func parseCustomColumn(spec string) (string, string, string, error) {
+	parts := strings.SplitN(spec, ":", 3)
+	switch {
+	case len(parts) < 2:
+		return "", "", "", nil
+	case len(parts) == 3 && isNodeType(parts[0]):
+		return parts[0], parts[1], parts[2], nil
+	case len(parts) == 3 && !strings.HasPrefix(parts[1], ".") && !strings.HasPrefix(parts[1], "{"):
+		types := []string{}
+		for _, nodeType := range nodeTypes {
+			types = append(types, nodeType)
+		}
+		sort.Strings(types)
+		return "", "", "", fmt.Errorf("Invalid custom column %q, unknown type %s, expected one of %s", spec, parts[0], strings.Join(types, ","))
+	}
+	return "", parts[0], strings.TrimPrefix(spec, parts[0]+":"), nil
+}
+
+func isNodeType(name string) bool {
+	for _, nodeType := range nodeTypes {
+		if nodeType == name {
+			return true
+		}
+	}
+	return false
+}
+
+// headers returns the table headers of the default view
+func (format *outputFormat) headers() []string {
+	if len(format.columns) != 0 {
+		headers := []string{"Resource Type", "Name"}
+		for _, column := range format.columns {
+			headers = append(headers, column.header)
+		}
+		return headers
+	}
+	headers := []string{"Resource Type", "Name", "Created At"}
+	if format.wide {
+		headers = append(headers, wideHeaders...)
+	}
+	return append(headers, "Status.Condition")
+}
+
+// options returns the verbose type and the columns of the row of a node
+func (format *outputFormat) options(node *ReportNode, verbose string) []Option {
+	switch {
+	case verbose == "keyinfo":
+		return []Option{WithVerboseType(verbose)}
+	case len(format.columns) != 0:
+		return []Option{WithVerboseType("custom"), WithColumns(format.customValues(node))}
+	case format.wide:
+		return []Option{WithVerboseType(verbose), WithColumns(wideValues(node))}
+	default:
+		return []Option{WithVerboseType(verbose)}
+	}
+}
+
+// summaryOptions returns the options of a free text row, the summary goes in the last custom column
+func (format *outputFormat) summaryOptions(summary, verbose string) []Option {
+	switch {
+	case verbose == "keyinfo":
+		return []Option{WithVerboseType(verbose)}
+	case len(format.columns) != 0:
+		columns := make([]string, len(format.columns))
+		columns[len(columns)-1] = summary
+		return []Option{WithVerboseType("custom"), WithColumns(columns)}
+	case format.wide:
+		return []Option{WithVerboseType(verbose), WithColumns(make([]string, len(wideHeaders)))}
+	default:
+		return []Option{WithVerboseType(verbose)}
+	}
+}
+
+// customValues evaluates the custom columns on the object of a node. A missing field is shown as <none>, a column
+// which is only defined for other types is left empty.
+func (format *outputFormat) customValues(node *ReportNode) []string {
+	values := []string{}
+	for _, column := range format.columns {
+		parser, ok := column.parsers[node.Type]
+		if !ok {
+			parser, ok = column.parsers[""]
+		}
+		if !ok {
+			values = append(values, "")
+			continue
+		}
+		value := "<none>"
+		if node.Object != nil {
+			results, err := parser.FindResults(node.Object.Object)
+			if err == nil {
+				found := []string{}
+				for _, result := range results {
+					for _, v := range result {
+						if v.IsValid() && v.CanInterface() {
+							found = append(found, fmt.Sprintf("%v", v.Interface()))
+						}
+					}
+				}
+				if len(found) != 0 {
+					value = strings.Join(found, ",")
+				}
+			}
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+// wideValues returns the age, the ready replicas, the node and the image digests of a node, when they apply to its type
+func wideValues(node *ReportNode) []string {
+	if node.Object == nil {
+		return make([]string, len(wideHeaders))
+	}
+	obj := node.Object.Object
+
+	age := ""
+	if created, ok := parseTime(unstructuredValue(obj, "metadata", "creationTimestamp")); ok {
+		age = duration.HumanDuration(time.Since(created))
+	}
+
+	ready := ""
+	switch node.Type {
+	case "deployment", "replicaset":
+		readyReplicas, _, _ := unstructured.NestedInt64(obj, "status", "readyReplicas")
+		replicas, _, _ := unstructured.NestedInt64(obj, "spec", "replicas")
+		ready = fmt.Sprintf("%d/%d", readyReplicas, replicas)
+	case "pod":
+		statuses, _, _ := unstructured.NestedSlice(obj, "status", "containerStatuses")
+		readyContainers := 0
+		for _, status := range statuses {
+			if m, ok := status.(map[string]interface{}); ok && m["ready"] == true {
+				readyContainers++
+			}
+		}
+		ready = fmt.Sprintf("%d/%d", readyContainers, len(statuses))
+	case "hpa":
+		currentReplicas, _, _ := unstructured.NestedInt64(obj, "status", "currentReplicas")
+		desiredReplicas, _, _ := unstructured.NestedInt64(obj, "status", "desiredReplicas")
+		ready = fmt.Sprintf("%d/%d", currentReplicas, desiredReplicas)
+	}
+
+	nodeName := ""
+	if node.Type == "pod" {
+		nodeName = stringValue(unstructuredValue(obj, "spec", "nodeName"))
+	}
+
+	return []string{age, ready, nodeName, strings.Join(imageDigests(node), ",")}
+}
+
+// imageDigests returns the digests the images of a revision or a pod were resolved to
+func imageDigests(node *ReportNode) []string {
+	digests := []string{}
+	statuses, _, _ := unstructured.NestedSlice(node.Object.Object, "status", "containerStatuses")
+	for _, status := range statuses {
+		m, ok := status.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		//a revision records imageDigest, a pod the imageID
+		image := stringValue(m["imageDigest"])
+		if image == "" {
+			image = stringValue(m["imageID"])
+		}
+		if i := strings.LastIndex(image, "@"); i != -1 {
+			digests = append(digests, image[i+1:])
+		}
+	}
+	return digests
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	. "knative.dev/kn-plugin-diag/pkg/models"
+	. "knative.dev/kn-plugin-diag/pkg/utils"
+)
+
+func TestParseOutputFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		wide    bool
+		headers []string
+		wantErr string
+	}{
+		{name: "default", output: ""},
+		{name: "wide", output: "wide", wide: true},
+		{name: "custom columns", output: "custom-columns=GEN:.metadata.generation,READY:{.status.conditions[?(@.type==\"Ready\")].status}", headers: []string{"GEN", "READY"}},
+		{name: "custom columns per type sharing a header", output: "custom-columns=revision:IMAGE:.spec.containers[0].image,pod:IMAGE:.spec.containers[0].image,GEN:.metadata.generation",
+			headers: []string{"IMAGE", "GEN"}},
+		{name: "missing colon", output: "custom-columns=GEN", wantErr: `Invalid custom column "GEN", expected [TYPE:]HEADER:JSONPATH`},
+		{name: "missing header", output: "custom-columns=:.metadata.name", wantErr: `Invalid custom column ":.metadata.name", expected [TYPE:]HEADER:JSONPATH`},
+		{name: "missing JSONPath after the type", output: "custom-columns=revision:IMAGE:", wantErr: `Invalid custom column "revision:IMAGE:", expected [TYPE:]HEADER:JSONPATH`},
+		{name: "bad JSONPath", output: "custom-columns=GEN:.metadata[", wantErr: `Invalid custom column "GEN:.metadata["`},
+		{name: "unknown type", output: "custom-columns=widget:GEN:.metadata.generation", wantErr: `Invalid custom column "widget:GEN:.metadata.generation", unknown type widget, expected one of configuration,deployment,hpa`},
+		{name: "JSONPath with a colon", output: "custom-columns=FIRST:{.spec.containers[0:1].image}", headers: []string{"FIRST"}},
+		{name: "duplicate column", output: "custom-columns=pod:IMAGE:.spec.image,pod:IMAGE:.status.image", wantErr: "the column IMAGE is already defined for this type"},
+		{name: "unknown format", output: "json", wantErr: `Unsupported output "json"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, err := parseOutputFormat(tt.output)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, format.wide, tt.wide)
+			headers := []string{}
+			for _, column := range format.columns {
+				headers = append(headers, column.header)
+			}
+			if tt.headers == nil {
+				tt.headers = []string{}
+			}
+			assert.DeepEqual(t, headers, tt.headers)
+		})
+	}
+}
+
+func TestCustomValues(t *testing.T) {
+	format, err := parseOutputFormat("custom-columns=revision:IMAGE:.spec.containers[0].image,pod:IMAGE:.spec.containers[*].image,NAME:.metadata.name,GEN:.metadata.generation")
+	assert.NilError(t, err)
+	node := func(nodeType string, object map[string]interface{}) *ReportNode {
+		return &ReportNode{Type: nodeType, Name: "hello", Object: &unstructured.Unstructured{Object: object}}
+	}
+	containers := []interface{}{
+		map[string]interface{}{"image": "ghcr.io/knative/hello:v1"},
+		map[string]interface{}{"image": "sidecar"},
+	}
+	tests := []struct {
+		name string
+		node *ReportNode
+		want []string
+	}{
+		{
+			name: "column of the type",
+			node: node("revision", map[string]interface{}{"metadata": map[string]interface{}{"name": "hello-00001", "generation": int64(1)},
+				"spec": map[string]interface{}{"containers": containers}}),
+			want: []string{"ghcr.io/knative/hello:v1", "hello-00001", "1"},
+		},
+		{
+			name: "several values",
+			node: node("pod", map[string]interface{}{"metadata": map[string]interface{}{"name": "hello-00001-deployment-abc-xyz"},
+				"spec": map[string]interface{}{"containers": containers}}),
+			want: []string{"ghcr.io/knative/hello:v1,sidecar", "hello-00001-deployment-abc-xyz", "<none>"},
+		},
+		{
+			name: "column of other types left empty",
+			node: node("ksvc", map[string]interface{}{"metadata": map[string]interface{}{"name": "hello", "generation": int64(2)}}),
+			want: []string{"", "hello", "2"},
+		},
+		{
+			name: "node without object",
+			node: &ReportNode{Type: "revision", Name: "hello-00001"},
+			want: []string{"<none>", "<none>", "<none>"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.DeepEqual(t, format.customValues(tt.node), tt.want)
+		})
+	}
+}
+
+func TestNoteRow(t *testing.T) {
+	replicaset := &ReportNode{
+		Type:      "replicaset",
+		Name:      "hello-00001-deployment-abc",
+		CreatedAt: "2021-06-01T10:00:00Z",
+		Note:      "deployment revision 1, scaled down to 0 when revision 2 was rolled out",
+		Object: &unstructured.Unstructured{Object: map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "hello-00001-deployment-abc", "generation": int64(3)},
+		}},
+	}
+	tests := []struct {
+		name    string
+		output  string
+		verbose string
+		want    []string
+	}{
+		{
+			name: "default",
+			want: []string{"replicaset", "hello-00001-deployment-abc", "2021-06-01T10:00:00Z", replicaset.Note},
+		},
+		{
+			name:    "keyinfo",
+			verbose: "keyinfo",
+			want:    []string{"replicaset", "hello-00001-deployment-abc", replicaset.Note},
+		},
+		{
+			name:   "custom columns",
+			output: "custom-columns=GEN:.metadata.generation",
+			want:   []string{"replicaset", "hello-00001-deployment-abc", "3", "note", replicaset.Note},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, err := parseOutputFormat(tt.output)
+			assert.NilError(t, err)
+			sc := &ServingConfiguration{conditionInfos: LoadServingConditionInfoConfiguration(), output: format, maxPods: maxPods}
+			buf := &bytes.Buffer{}
+			table := NewTable(buf, format.headers())
+			assert.NilError(t, sc.deepFirstRetrieveObjects(replicaset, 0, table, tt.verbose))
+			table.Print()
+			for _, want := range tt.want {
+				assert.Assert(t, strings.Contains(buf.String(), want), "%q not in\n%s", want, buf.String())
+			}
+		})
+	}
+}
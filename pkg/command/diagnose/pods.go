@@ -0,0 +1,150 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	. "knative.dev/kn-plugin-diag/pkg/models"
+)
+
+// podHealthyState is the state of a pod serving traffic
+const podHealthyState = "Running/Ready"
+
+var (
+	// maxPods is the maximum number of unhealthy pods shown in detail under a replicaset
+	maxPods = 10
+)
+
+// podState returns a short state of a pod, e.g. Running/Ready, CrashLoopBackOff or Pending: Unschedulable
+func podState(pod *unstructured.Unstructured) string {
+	if pod.GetDeletionTimestamp() != nil {
+		return "Terminating"
+	}
+
+	statuses, _, _ := unstructured.NestedSlice(pod.Object, "status", "containerStatuses")
+	for _, status := range statuses {
+		m, ok := status.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, state := range []string{"waiting", "terminated"} {
+			if reason := stringValue(unstructuredValue(m, "state", state, "reason")); reason != "" {
+				return reason
+			}
+		}
+	}
+
+	phase := stringValue(unstructuredValue(pod.Object, "status", "phase"))
+	switch phase {
+	case "Pending":
+		if reason := podConditionReason(pod, "PodScheduled"); reason != "" {
+			return phase + ": " + reason
+		}
+	case "Running":
+		if podConditionStatus(pod, "Ready") == "True" {
+			return podHealthyState
+		}
+		return "Running/NotReady"
+	case "Failed":
+		if reason := stringValue(unstructuredValue(pod.Object, "status", "reason")); reason != "" {
+			return phase + ": " + reason
+		}
+	case "":
+		return "Unknown"
+	}
+	return phase
+}
+
+func podConditionStatus(pod *unstructured.Unstructured, conditionType string) string {
+	return stringValue(podCondition(pod, conditionType)["status"])
+}
+
+// podConditionReason returns the reason of a condition which is not True
+func podConditionReason(pod *unstructured.Unstructured, conditionType string) string {
+	condition := podCondition(pod, conditionType)
+	if stringValue(condition["status"]) == "True" {
+		return ""
+	}
+	return stringValue(condition["reason"])
+}
+
+func podCondition(pod *unstructured.Unstructured, conditionType string) map[string]interface{} {
+	conditions, _, _ := unstructured.NestedSlice(pod.Object, "status", "conditions")
+	for _, condition := range conditions {
+		if m, ok := condition.(map[string]interface{}); ok && stringValue(m["type"]) == conditionType {
+			return m
+		}
+	}
+	return nil
+}
+
+// splitPods separates the pod nodes from the other leaves of a node
+func splitPods(leaves []*ReportNode) ([]*ReportNode, []*ReportNode) {
+	others, pods := []*ReportNode{}, []*ReportNode{}
+	for _, leaf := range leaves {
+		if leaf.Type == "pod" {
+			pods = append(pods, leaf)
+		} else {
+			others = append(others, leaf)
+		}
+	}
+	return others, pods
+}
+
+// summarizePods groups the pods by state, e.g. "37 Running/Ready, 2 CrashLoopBackOff, 1 Pending: Unschedulable",
+// and returns the unhealthy pods to show in detail, at most max of them
+func summarizePods(pods []*ReportNode, max int) (string, []*ReportNode) {
+	counts := make(map[string]int)
+	unhealthy := []*ReportNode{}
+	for _, pod := range pods {
+		state := podState(pod.Object)
+		counts[state]++
+		if state != podHealthyState {
+			unhealthy = append(unhealthy, pod)
+		}
+	}
+
+	states := make([]string, 0, len(counts))
+	for state := range counts {
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		if counts[states[i]] != counts[states[j]] {
+			return counts[states[i]] > counts[states[j]]
+		}
+		return states[i] < states[j]
+	})
+	groups := make([]string, 0, len(states))
+	for _, state := range states {
+		groups = append(groups, fmt.Sprintf("%d %s", counts[state], state))
+	}
+	summary := strings.Join(groups, ", ")
+
+	if max < 0 {
+		max = 0
+	}
+	if len(unhealthy) > max {
+		summary = fmt.Sprintf("%s (%d unhealthy pods not shown, see --max-pods)", summary, len(unhealthy)-max)
+		unhealthy = unhealthy[:max]
+	}
+	return summary, unhealthy
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	. "knative.dev/kn-plugin-diag/pkg/models"
+)
+
+// testPod returns a pod in phase whose Ready and PodScheduled conditions and user-container state are set when not empty
+func testPod(name, phase, ready, waiting string) *unstructured.Unstructured {
+	status := map[string]interface{}{"phase": phase}
+	conditions := []interface{}{}
+	if ready != "" {
+		conditions = append(conditions, map[string]interface{}{"type": "Ready", "status": ready})
+	}
+	if phase == "Pending" {
+		conditions = append(conditions, map[string]interface{}{"type": "PodScheduled", "status": "False", "reason": "Unschedulable"})
+	}
+	status["conditions"] = conditions
+	if waiting != "" {
+		status["containerStatuses"] = []interface{}{map[string]interface{}{
+			"name":  "user-container",
+			"state": map[string]interface{}{"waiting": map[string]interface{}{"reason": waiting}},
+		}}
+	}
+	pod := &unstructured.Unstructured{Object: map[string]interface{}{"status": status}}
+	pod.SetName(name)
+	return pod
+}
+
+func TestPodState(t *testing.T) {
+	terminating := testPod("hello", "Running", "True", "")
+	now := metav1.Now()
+	terminating.SetDeletionTimestamp(&now)
+	failed := testPod("hello", "Failed", "", "")
+	failed.Object["status"].(map[string]interface{})["reason"] = "Evicted"
+
+	tests := []struct {
+		name  string
+		pod   *unstructured.Unstructured
+		state string
+	}{
+		{"running and ready", testPod("hello", "Running", "True", ""), podHealthyState},
+		{"running not ready", testPod("hello", "Running", "False", ""), "Running/NotReady"},
+		{"container waiting", testPod("hello", "Running", "False", "CrashLoopBackOff"), "CrashLoopBackOff"},
+		{"pending unschedulable", testPod("hello", "Pending", "", ""), "Pending: Unschedulable"},
+		{"failed with reason", failed, "Failed: Evicted"},
+		{"succeeded", testPod("hello", "Succeeded", "", ""), "Succeeded"},
+		{"no phase", testPod("hello", "", "", ""), "Unknown"},
+		{"terminating", terminating, "Terminating"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, podState(tt.pod), tt.state)
+		})
+	}
+}
+
+func TestSummarizePods(t *testing.T) {
+	pods := []*ReportNode{
+		{Type: "pod", Name: "a", Object: testPod("a", "Running", "True", "")},
+		{Type: "pod", Name: "b", Object: testPod("b", "Running", "False", "CrashLoopBackOff")},
+		{Type: "pod", Name: "c", Object: testPod("c", "Running", "True", "")},
+		{Type: "pod", Name: "d", Object: testPod("d", "Pending", "", "")},
+		{Type: "pod", Name: "e", Object: testPod("e", "Running", "False", "CrashLoopBackOff")},
+	}
+	tests := []struct {
+		name      string
+		max       int
+		summary   string
+		unhealthy []string
+	}{
+		{
+			name:      "all unhealthy pods shown",
+			max:       10,
+			summary:   "2 CrashLoopBackOff, 2 Running/Ready, 1 Pending: Unschedulable",
+			unhealthy: []string{"b", "d", "e"},
+		},
+		{
+			name:      "unhealthy pods capped",
+			max:       1,
+			summary:   "2 CrashLoopBackOff, 2 Running/Ready, 1 Pending: Unschedulable (2 unhealthy pods not shown, see --max-pods)",
+			unhealthy: []string{"b"},
+		},
+		{
+			name:      "negative max",
+			max:       -1,
+			summary:   "2 CrashLoopBackOff, 2 Running/Ready, 1 Pending: Unschedulable (3 unhealthy pods not shown, see --max-pods)",
+			unhealthy: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summary, unhealthy := summarizePods(pods, tt.max)
+			assert.Equal(t, summary, tt.summary)
+			names := []string{}
+			for _, pod := range unhealthy {
+				names = append(names, pod.Name)
+			}
+			assert.DeepEqual(t, names, tt.unhealthy)
+		})
+	}
+}
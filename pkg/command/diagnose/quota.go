@@ -0,0 +1,589 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"knative.dev/pkg/kmap"
+	servingconfig "knative.dev/serving/pkg/apis/config"
+	"knative.dev/serving/pkg/apis/serving"
+	"knative.dev/serving/pkg/deployment"
+
+	. "knative.dev/kn-plugin-diag/pkg/utils"
+)
+
+const queueProxyContainerName = "queue-proxy"
+
+var (
+	checkQuota bool
+
+	resourceQuotasGVR = schema.GroupVersionResource{Group: "", Version: "v1", Resource: "resourcequotas"}
+	limitRangesGVR    = schema.GroupVersionResource{Group: "", Version: "v1", Resource: "limitranges"}
+
+	// quotaPodResources maps the resources of a ResourceQuota which count the pods to the resource of the pods
+	// they sum, and whether they sum the limits instead of the requests
+	quotaPodResources = map[corev1.ResourceName]struct {
+		resource corev1.ResourceName
+		limit    bool
+	}{
+		corev1.ResourceCPU:                      {corev1.ResourceCPU, false},
+		corev1.ResourceRequestsCPU:              {corev1.ResourceCPU, false},
+		corev1.ResourceLimitsCPU:                {corev1.ResourceCPU, true},
+		corev1.ResourceMemory:                   {corev1.ResourceMemory, false},
+		corev1.ResourceRequestsMemory:           {corev1.ResourceMemory, false},
+		corev1.ResourceLimitsMemory:             {corev1.ResourceMemory, true},
+		corev1.ResourceEphemeralStorage:         {corev1.ResourceEphemeralStorage, false},
+		corev1.ResourceRequestsEphemeralStorage: {corev1.ResourceEphemeralStorage, false},
+		corev1.ResourceLimitsEphemeralStorage:   {corev1.ResourceEphemeralStorage, true},
+	}
+)
+
+// containerResources are the resources of a container of the pods of a revision once created, and where they come from
+type containerResources struct {
+	name     string
+	init     bool
+	requests corev1.ResourceList
+	limits   corev1.ResourceList
+	sources  []string
+}
+
+// constraintCheck is a constraint of a ResourceQuota or a LimitRange on the pods of a revision, fits is the number
+// of pods it still admits and is negative when it does not bound the number of pods
+type constraintCheck struct {
+	constraint string
+	resource   string
+	perPod     string
+	bound      string
+	fits       int64
+}
+
+// printQuotaCheck compares the resources of the pods of every revision of the tree to the ResourceQuotas and
+// LimitRanges of the namespace, and tells which constraint blocks the scaling and how many more pods fit
+func printQuotaCheck(sc *ServingConfiguration) {
+	quotas, limitRanges := sc.loadResourceConstraints()
+	_, deploymentConfig := sc.loadDeploymentConfig()
+	features := sc.loadFeaturesConfig()
+	c := color.New(color.FgRed).Add(color.Bold)
+
+	for _, revision := range findReportNodes(sc.report.Root, "revision") {
+		containers := revisionPodResources(revision.Object, deploymentConfig, features, limitRanges)
+		fmt.Printf("\nResources of the pods of revision %s\n", revision.Name)
+		table := NewTable(os.Stdout, []string{"Container", "Requests", "Limits", "Source"})
+		table.SetSeperator(false)
+		for _, container := range containers {
+			name := container.name
+			if container.init {
+				name += " (init)"
+			}
+			table.Add([]string{name, formatResourceList(container.requests), formatResourceList(container.limits), strings.Join(container.sources, ", ")})
+		}
+		table.Add([]string{"pod", formatResourceList(podResources(containers, false)), formatResourceList(podResources(containers, true)),
+			"sum of the containers, or the largest init container when higher"})
+		table.Print()
+
+		if len(quotas) == 0 && len(limitRanges) == 0 {
+			fmt.Printf("No ResourceQuota or LimitRange in namespace %s\n", sc.Namespace)
+			continue
+		}
+		checks := append(checkLimitRanges(containers, limitRanges), checkResourceQuotas(containers, quotas)...)
+		fmt.Printf("\nResourceQuotas and LimitRanges of namespace %s\n", sc.Namespace)
+		table = NewTable(os.Stdout, []string{"Constraint", "Resource", "Per Pod", "Bound", "More Pods"})
+		table.SetSeperator(false)
+		var blocking *constraintCheck
+		for i, check := range checks {
+			fits := "-"
+			switch {
+			case check.fits == 0:
+				fits = c.Sprintf("0")
+			case check.fits > 0:
+				fits = strconv.FormatInt(check.fits, 10)
+			}
+			table.Add([]string{check.constraint, check.resource, check.perPod, check.bound, fits})
+			if check.fits >= 0 && (blocking == nil || check.fits < blocking.fits) {
+				blocking = &checks[i]
+			}
+		}
+		table.Print()
+
+		switch {
+		case blocking == nil:
+			fmt.Printf("* No ResourceQuota bounds the number of pods of revision %s\n", revision.Name)
+		case blocking.fits == 0:
+			fmt.Printf("* %s\n", c.Sprintf("No more pod of revision %s can be created, blocked by %s on %s", revision.Name, blocking.constraint, blocking.resource))
+		default:
+			pods := "pods fit"
+			if blocking.fits == 1 {
+				pods = "pod fits"
+			}
+			fmt.Printf("* %d more %s for revision %s, %s on %s is the first to block\n", blocking.fits, pods, revision.Name, blocking.constraint, blocking.resource)
+		}
+		for _, deploymentNode := range findReportNodes(revision, "deployment") {
+			if failure := conditionOf(deploymentNode.Object, "ReplicaFailure"); failure != nil && stringValue(failure["status"]) == "True" {
+				fmt.Printf("* Deployment %s: %s\n", deploymentNode.Name, stringValue(failure["message"]))
+			}
+		}
+	}
+}
+
+// loadResourceConstraints returns the ResourceQuotas and the LimitRanges of the namespace of the ksvc
+func (sc *ServingConfiguration) loadResourceConstraints() ([]corev1.ResourceQuota, []corev1.LimitRange) {
+	quotas := []corev1.ResourceQuota{}
+	limitRanges := []corev1.LimitRange{}
+	if list, err := sc.dynClient.Resource(resourceQuotasGVR).Namespace(sc.Namespace).List(sc.ctx, metav1.ListOptions{}); err != nil {
+		sc.warn("Failed to list the resourcequotas of namespace %s, %v\n", sc.Namespace, err)
+	} else {
+		for _, item := range list.Items {
+			quota := corev1.ResourceQuota{}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, &quota); err == nil {
+				quotas = append(quotas, quota)
+			}
+		}
+	}
+	if list, err := sc.dynClient.Resource(limitRangesGVR).Namespace(sc.Namespace).List(sc.ctx, metav1.ListOptions{}); err != nil {
+		sc.warn("Failed to list the limitranges of namespace %s, %v\n", sc.Namespace, err)
+	} else {
+		for _, item := range list.Items {
+			limitRange := corev1.LimitRange{}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, &limitRange); err == nil {
+				limitRanges = append(limitRanges, limitRange)
+			}
+		}
+	}
+	return quotas, limitRanges
+}
+
+// revisionPodResources returns the resources of the containers of the pods of a revision: the init and user containers
+// of the revision and the queue-proxy, with the defaults of the LimitRanges applied like the admission does
+func revisionPodResources(revision *unstructured.Unstructured, config *deployment.Config, features *servingconfig.Features,
+	limitRanges []corev1.LimitRange) []containerResources {
+	containers := []containerResources{}
+	initContainers, _, _ := unstructured.NestedSlice(revision.Object, "spec", "initContainers")
+	for _, container := range initContainers {
+		if ct, ok := container.(map[string]interface{}); ok {
+			resources := specContainerResources(ct)
+			resources.init = true
+			containers = append(containers, resources)
+		}
+	}
+	specContainers, _, _ := unstructured.NestedSlice(revision.Object, "spec", "containers")
+	userContainer := containerResources{}
+	for _, container := range specContainers {
+		ct, ok := container.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		resources := specContainerResources(ct)
+		//the name of a single container is defaulted by the webhook
+		if resources.name == "" {
+			resources.name = "user-container"
+		}
+		//the queue-proxy forwards to the container with a port, the only container when there is one
+		if _, ok := ct["ports"]; ok || len(specContainers) == 1 {
+			userContainer = resources
+		}
+		containers = append(containers, resources)
+	}
+	containers = append(containers, queueProxyResources(revision.GetAnnotations(), config, features, userContainer))
+
+	for i := range containers {
+		applyLimitRangeDefaults(&containers[i], limitRanges)
+	}
+	return containers
+}
+
+func specContainerResources(container map[string]interface{}) containerResources {
+	resources := corev1.ResourceRequirements{}
+	if r, ok := container["resources"].(map[string]interface{}); ok {
+		_ = runtime.DefaultUnstructuredConverter.FromUnstructured(r, &resources)
+	}
+	return containerResources{
+		name:     stringValue(container["name"]),
+		requests: orEmptyResourceList(resources.Requests),
+		limits:   orEmptyResourceList(resources.Limits),
+		sources:  []string{"revision"},
+	}
+}
+
+// queueProxyResources returns the resources of the queue-proxy like the revision reconciler: the ones of config-deployment,
+// or their defaults when queueproxy.resource-defaults is enabled, then a share of the resources of the user container
+// when the resource-percentage annotation is set, overridden by the queue.sidecar.serving.knative.dev annotations
+func queueProxyResources(annotations map[string]string, config *deployment.Config, features *servingconfig.Features,
+	userContainer containerResources) containerResources {
+	qp := containerResources{name: queueProxyContainerName, requests: corev1.ResourceList{}, limits: corev1.ResourceList{}}
+	useDefaults := features.QueueProxyResourceDefaults == servingconfig.Enabled
+	fromConfig, fromPercentage, fromAnnotations := false, false, false
+	for _, r := range []struct {
+		name                         corev1.ResourceName
+		request, limit               *resource.Quantity
+		requestDefault, limitDefault *resource.Quantity
+	}{{
+		corev1.ResourceCPU, config.QueueSidecarCPURequest, config.QueueSidecarCPULimit,
+		&deployment.QueueSidecarCPURequestDefault, &deployment.QueueSidecarCPULimitDefault,
+	}, {
+		corev1.ResourceMemory, config.QueueSidecarMemoryRequest, config.QueueSidecarMemoryLimit,
+		&deployment.QueueSidecarMemoryRequestDefault, &deployment.QueueSidecarMemoryLimitDefault,
+	}, {
+		corev1.ResourceEphemeralStorage, config.QueueSidecarEphemeralStorageRequest, config.QueueSidecarEphemeralStorageLimit,
+		&deployment.QueueSidecarEphemeralStorageRequestDefault, &deployment.QueueSidecarEphemeralStorageLimitDefault,
+	}} {
+		if r.request != nil {
+			qp.requests[r.name] = *r.request
+			fromConfig = true
+		} else if useDefaults && r.requestDefault != nil {
+			qp.requests[r.name] = *r.requestDefault
+			fromConfig = true
+		}
+		if r.limit != nil {
+			qp.limits[r.name] = *r.limit
+			fromConfig = true
+		} else if useDefaults && r.limitDefault != nil {
+			qp.limits[r.name] = *r.limitDefault
+			fromConfig = true
+		}
+	}
+
+	if _, v, ok := serving.QueueSidecarResourcePercentageAnnotation.Get(annotations); ok {
+		if percentage, err := strconv.ParseFloat(v, 64); err == nil {
+			for _, r := range []struct {
+				list     corev1.ResourceList
+				name     corev1.ResourceName
+				user     corev1.ResourceList
+				boundary queueResourceBoundary
+			}{
+				{qp.requests, corev1.ResourceCPU, userContainer.requests, queueRequestCPUBoundary},
+				{qp.limits, corev1.ResourceCPU, userContainer.limits, queueLimitCPUBoundary},
+				{qp.requests, corev1.ResourceMemory, userContainer.requests, queueRequestMemoryBoundary},
+				{qp.limits, corev1.ResourceMemory, userContainer.limits, queueLimitMemoryBoundary},
+			} {
+				if q, ok := r.user[r.name]; ok && !q.IsZero() {
+					r.list[r.name] = r.boundary.apply(percentageOf(q, percentage/100))
+					fromPercentage = true
+				}
+			}
+		}
+	}
+
+	for _, r := range []struct {
+		list       corev1.ResourceList
+		name       corev1.ResourceName
+		annotation kmap.KeyPriority
+	}{
+		{qp.requests, corev1.ResourceCPU, serving.QueueSidecarCPUResourceRequestAnnotation},
+		{qp.limits, corev1.ResourceCPU, serving.QueueSidecarCPUResourceLimitAnnotation},
+		{qp.requests, corev1.ResourceMemory, serving.QueueSidecarMemoryResourceRequestAnnotation},
+		{qp.limits, corev1.ResourceMemory, serving.QueueSidecarMemoryResourceLimitAnnotation},
+		{qp.requests, corev1.ResourceEphemeralStorage, serving.QueueSidecarEphemeralStorageResourceRequestAnnotation},
+		{qp.limits, corev1.ResourceEphemeralStorage, serving.QueueSidecarEphemeralStorageResourceLimitAnnotation},
+	} {
+		if _, v, ok := r.annotation.Get(annotations); ok {
+			if q, err := resource.ParseQuantity(v); err == nil {
+				r.list[r.name] = q
+				fromAnnotations = true
+			}
+		}
+	}
+
+	if fromConfig {
+		qp.sources = append(qp.sources, deployment.ConfigName)
+	}
+	if fromPercentage {
+		qp.sources = append(qp.sources, "resource-percentage of "+userContainer.name)
+	}
+	if fromAnnotations {
+		qp.sources = append(qp.sources, "queue.sidecar annotations")
+	}
+	return qp
+}
+
+// queueResourceBoundary bounds the queue-proxy resources computed from the resource-percentage annotation
+type queueResourceBoundary struct {
+	min, max resource.Quantity
+}
+
+// the bounds of the revision reconciler of Knative Serving, they are not exported
+var (
+	queueRequestCPUBoundary    = queueResourceBoundary{resource.MustParse("25m"), resource.MustParse("100m")}
+	queueLimitCPUBoundary      = queueResourceBoundary{resource.MustParse("40m"), resource.MustParse("500m")}
+	queueRequestMemoryBoundary = queueResourceBoundary{resource.MustParse("50Mi"), resource.MustParse("200Mi")}
+	queueLimitMemoryBoundary   = queueResourceBoundary{resource.MustParse("200Mi"), resource.MustParse("500Mi")}
+)
+
+func (b queueResourceBoundary) apply(q resource.Quantity) resource.Quantity {
+	switch {
+	case q.Cmp(b.min) < 0:
+		return b.min
+	case q.Cmp(b.max) > 0:
+		return b.max
+	}
+	return q
+}
+
+// percentageOf returns the fraction of a quantity, capped to the largest milli value
+func percentageOf(q resource.Quantity, fraction float64) resource.Quantity {
+	milli := int64(math.MaxInt64 - 1)
+	if q.Value() < math.MaxInt64/1000 {
+		milli = q.MilliValue()
+	}
+	value := float64(milli) * fraction
+	if value >= math.MaxInt64 {
+		return *resource.NewMilliQuantity(math.MaxInt64, resource.BinarySI)
+	}
+	return *resource.NewMilliQuantity(int64(value), resource.BinarySI)
+}
+
+// podResources returns the requests or the limits of a pod like the scheduler and the ResourceQuotas count them: the
+// sum of the containers, or the largest init container when it needs more since the init containers run one at a time
+func podResources(containers []containerResources, limits bool) corev1.ResourceList {
+	sum, largestInit := corev1.ResourceList{}, corev1.ResourceList{}
+	for _, container := range containers {
+		list := container.requests
+		if limits {
+			list = container.limits
+		}
+		if !container.init {
+			addResourceList(sum, list)
+			continue
+		}
+		for name, q := range list {
+			if largest, ok := largestInit[name]; !ok || q.Cmp(largest) > 0 {
+				largestInit[name] = q
+			}
+		}
+	}
+	for name, q := range largestInit {
+		if total, ok := sum[name]; !ok || q.Cmp(total) > 0 {
+			sum[name] = q
+		}
+	}
+	return sum
+}
+
+// applyLimitRangeDefaults sets the requests and limits a container does not set like the api server and the
+// LimitRanger admission: a missing request defaults to the limit, then to the defaults of the Container LimitRanges
+func applyLimitRangeDefaults(container *containerResources, limitRanges []corev1.LimitRange) {
+	for name, limit := range container.limits {
+		if _, ok := container.requests[name]; !ok {
+			container.requests[name] = limit
+		}
+	}
+	for _, limitRange := range limitRanges {
+		for _, item := range limitRange.Spec.Limits {
+			if item.Type != corev1.LimitTypeContainer {
+				continue
+			}
+			for name, q := range item.Default {
+				if _, ok := container.limits[name]; !ok {
+					container.limits[name] = q
+					container.sources = append(container.sources, fmt.Sprintf("limits.%s from LimitRange %s", name, limitRange.Name))
+				}
+			}
+			for name, q := range item.DefaultRequest {
+				if _, ok := container.requests[name]; !ok {
+					container.requests[name] = q
+					container.sources = append(container.sources, fmt.Sprintf("requests.%s from LimitRange %s", name, limitRange.Name))
+				}
+			}
+		}
+	}
+}
+
+// checkLimitRanges checks the min, max and maxLimitRequestRatio of the LimitRanges against every container and the pod,
+// a pod which violates one is rejected so no pod fits
+func checkLimitRanges(containers []containerResources, limitRanges []corev1.LimitRange) []constraintCheck {
+	checks := []constraintCheck{}
+	podRequests, podLimits := podResources(containers, false), podResources(containers, true)
+	for _, limitRange := range limitRanges {
+		constraint := "LimitRange " + limitRange.Name
+		for _, item := range limitRange.Spec.Limits {
+			switch item.Type {
+			case corev1.LimitTypeContainer:
+				for _, container := range containers {
+					checks = append(checks, checkLimitRangeItem(constraint, "container "+container.name, item, container.requests, container.limits)...)
+				}
+			case corev1.LimitTypePod:
+				checks = append(checks, checkLimitRangeItem(constraint, "pod", item, podRequests, podLimits)...)
+			}
+		}
+	}
+	return checks
+}
+
+// checkLimitRangeItem returns the violations of a LimitRange item by the requests and limits of a container or a pod
+func checkLimitRangeItem(constraint, target string, item corev1.LimitRangeItem, requests, limits corev1.ResourceList) []constraintCheck {
+	checks := []constraintCheck{}
+	for _, name := range sortedResourceNames(item.Max) {
+		max := item.Max[name]
+		limit, ok := limits[name]
+		switch {
+		case !ok:
+			checks = append(checks, constraintCheck{constraint, fmt.Sprintf("max %s of %s", name, target), "no limit", "max " + max.String(), 0})
+		case limit.Cmp(max) > 0:
+			checks = append(checks, constraintCheck{constraint, fmt.Sprintf("max %s of %s", name, target), "limit " + limit.String(), "max " + max.String(), 0})
+		}
+	}
+	for _, name := range sortedResourceNames(item.Min) {
+		min := item.Min[name]
+		request, ok := requests[name]
+		switch {
+		case !ok:
+			checks = append(checks, constraintCheck{constraint, fmt.Sprintf("min %s of %s", name, target), "no request", "min " + min.String(), 0})
+		case request.Cmp(min) < 0:
+			checks = append(checks, constraintCheck{constraint, fmt.Sprintf("min %s of %s", name, target), "request " + request.String(), "min " + min.String(), 0})
+		}
+	}
+	for _, name := range sortedResourceNames(item.MaxLimitRequestRatio) {
+		ratio := item.MaxLimitRequestRatio[name]
+		request, hasRequest := requests[name]
+		limit, hasLimit := limits[name]
+		if !hasRequest || !hasLimit || request.IsZero() {
+			continue
+		}
+		if float64(limit.MilliValue())/float64(request.MilliValue()) > float64(ratio.MilliValue())/1000 {
+			checks = append(checks, constraintCheck{constraint, fmt.Sprintf("maxLimitRequestRatio %s of %s", name, target),
+				fmt.Sprintf("%s/%s", limit.String(), request.String()), "ratio " + ratio.String(), 0})
+		}
+	}
+	return checks
+}
+
+// checkResourceQuotas computes how many more pods each ResourceQuota admits, from the room left between its used and
+// hard amounts and the requests or limits of a pod
+func checkResourceQuotas(containers []containerResources, quotas []corev1.ResourceQuota) []constraintCheck {
+	checks := []constraintCheck{}
+	bestEffort := true
+	for _, container := range containers {
+		if len(container.requests) != 0 || len(container.limits) != 0 {
+			bestEffort = false
+		}
+	}
+	for _, quota := range quotas {
+		constraint := "ResourceQuota " + quota.Name
+		if !quotaAppliesToPods(quota, bestEffort) {
+			continue
+		}
+		for _, name := range sortedResourceNames(quota.Spec.Hard) {
+			hard := quota.Spec.Hard[name]
+			used := quota.Status.Used[name]
+			bound := fmt.Sprintf("%s used of %s", used.String(), hard.String())
+			if name == corev1.ResourcePods || name == "count/pods" {
+				checks = append(checks, constraintCheck{constraint, string(name), "1", bound, podsLeft(hard, used, resource.MustParse("1"))})
+				continue
+			}
+			podResource, ok := quotaPodResources[name]
+			if !ok {
+				continue
+			}
+			//the quota admission rejects the pods with a container, init ones included, not setting the resource
+			missing := []string{}
+			for _, container := range containers {
+				list := container.requests
+				if podResource.limit {
+					list = container.limits
+				}
+				if _, ok := list[podResource.resource]; !ok {
+					missing = append(missing, container.name)
+				}
+			}
+			if len(missing) != 0 {
+				checks = append(checks, constraintCheck{constraint, string(name), "not set by " + strings.Join(missing, ","), bound, 0})
+				continue
+			}
+			perPod := podResources(containers, podResource.limit)[podResource.resource]
+			checks = append(checks, constraintCheck{constraint, string(name), perPod.String(), bound, podsLeft(hard, used, perPod)})
+		}
+	}
+	return checks
+}
+
+// quotaAppliesToPods tells whether the scopes of a ResourceQuota match the pods of a revision, which never terminate
+func quotaAppliesToPods(quota corev1.ResourceQuota, bestEffort bool) bool {
+	for _, scope := range quota.Spec.Scopes {
+		switch scope {
+		case corev1.ResourceQuotaScopeTerminating:
+			return false
+		case corev1.ResourceQuotaScopeBestEffort:
+			if !bestEffort {
+				return false
+			}
+		case corev1.ResourceQuotaScopeNotBestEffort:
+			if bestEffort {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// podsLeft returns how many pods needing perPod fit in the room left by a quota
+func podsLeft(hard, used, perPod resource.Quantity) int64 {
+	left := hard.DeepCopy()
+	left.Sub(used)
+	if left.Sign() <= 0 {
+		return 0
+	}
+	if perPod.IsZero() {
+		return -1
+	}
+	return left.MilliValue() / perPod.MilliValue()
+}
+
+func addResourceList(sum, list corev1.ResourceList) {
+	for name, q := range list {
+		total := sum[name]
+		total.Add(q)
+		sum[name] = total
+	}
+}
+
+func orEmptyResourceList(list corev1.ResourceList) corev1.ResourceList {
+	if list == nil {
+		return corev1.ResourceList{}
+	}
+	return list
+}
+
+func sortedResourceNames(list corev1.ResourceList) []corev1.ResourceName {
+	names := make([]corev1.ResourceName, 0, len(list))
+	for name := range list {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
+// formatResourceList formats a resource list like `cpu=100m,memory=128Mi`
+func formatResourceList(list corev1.ResourceList) string {
+	parts := []string{}
+	for _, name := range sortedResourceNames(list) {
+		q := list[name]
+		parts = append(parts, fmt.Sprintf("%s=%s", name, q.String()))
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	servingconfig "knative.dev/serving/pkg/apis/config"
+	"knative.dev/serving/pkg/deployment"
+)
+
+func TestQueueProxyResources(t *testing.T) {
+	userContainer := containerResources{
+		name:     "user-container",
+		requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1"), corev1.ResourceMemory: resource.MustParse("4Gi")},
+		limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("200m")},
+	}
+	tests := []struct {
+		name        string
+		deployment  map[string]string
+		features    map[string]string
+		annotations map[string]string
+		requests    string
+		limits      string
+		sources     []string
+	}{
+		{
+			name:     "defaults of config-deployment",
+			requests: "cpu=25m",
+			sources:  []string{deployment.ConfigName},
+		},
+		{
+			name:     "resource defaults enabled",
+			features: map[string]string{"queueproxy.resource-defaults": "enabled"},
+			requests: "cpu=25m,ephemeral-storage=512Mi,memory=400Mi",
+			limits:   "cpu=1,ephemeral-storage=1Gi,memory=800Mi",
+			sources:  []string{deployment.ConfigName},
+		},
+		{
+			name:        "resource percentage bounded",
+			annotations: map[string]string{"queue.sidecar.serving.knative.dev/resource-percentage": "10"},
+			requests:    "cpu=100m,memory=200Mi",
+			limits:      "cpu=40m",
+			sources:     []string{deployment.ConfigName, "resource-percentage of user-container"},
+		},
+		{
+			name: "annotations win over the percentage",
+			annotations: map[string]string{
+				"queue.sidecar.serving.knative.dev/resource-percentage":              "10",
+				"queue.sidecar.serving.knative.dev/cpu-resource-request":             "60m",
+				"queue.sidecar.serving.knative.dev/ephemeral-storage-resource-limit": "2Gi",
+			},
+			requests: "cpu=60m,memory=200Mi",
+			limits:   "cpu=40m,ephemeral-storage=2Gi",
+			sources:  []string{deployment.ConfigName, "resource-percentage of user-container", "queue.sidecar annotations"},
+		},
+		{
+			name:       "config-deployment",
+			deployment: map[string]string{"queue-sidecar-memory-request": "64Mi", "queue-sidecar-ephemeral-storage-limit": "256Mi"},
+			requests:   "cpu=25m,memory=64Mi",
+			limits:     "ephemeral-storage=256Mi",
+			sources:    []string{deployment.ConfigName},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := deployment.NewConfigFromMap(withQueueSidecarImage(tt.deployment))
+			assert.NilError(t, err)
+			features, err := servingconfig.NewFeaturesConfigFromMap(tt.features)
+			assert.NilError(t, err)
+			qp := queueProxyResources(tt.annotations, config, features, userContainer)
+			assert.Equal(t, formatResourceList(qp.requests), tt.requests)
+			assert.Equal(t, formatResourceList(qp.limits), tt.limits)
+			assert.DeepEqual(t, qp.sources, tt.sources)
+		})
+	}
+}
+
+func TestPodResources(t *testing.T) {
+	tests := []struct {
+		name       string
+		containers []containerResources
+		requests   string
+	}{
+		{
+			name: "sum of the containers",
+			containers: []containerResources{
+				{name: "user-container", requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("200m")}},
+				{name: "queue-proxy", requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("25m")}},
+			},
+			requests: "cpu=225m",
+		},
+		{
+			name: "largest init container",
+			containers: []containerResources{
+				{name: "migrate", init: true, requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1"), corev1.ResourceMemory: resource.MustParse("64Mi")}},
+				{name: "warmup", init: true, requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m")}},
+				{name: "user-container", requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("200m"), corev1.ResourceMemory: resource.MustParse("1Gi")}},
+				{name: "queue-proxy", requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("25m")}},
+			},
+			requests: "cpu=1,memory=1Gi",
+		},
+		{
+			name: "resource only set by an init container",
+			containers: []containerResources{
+				{name: "migrate", init: true, requests: corev1.ResourceList{corev1.ResourceEphemeralStorage: resource.MustParse("1Gi")}},
+				{name: "user-container", requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("200m")}},
+			},
+			requests: "cpu=200m,ephemeral-storage=1Gi",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, formatResourceList(podResources(tt.containers, false)), tt.requests)
+		})
+	}
+}
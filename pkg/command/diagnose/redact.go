@@ -0,0 +1,75 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"github.com/spf13/pflag"
+
+	"knative.dev/kn-plugin-diag/pkg/diagnosis"
+	. "knative.dev/kn-plugin-diag/pkg/utils"
+)
+
+var (
+	noRedact       bool
+	redactPatterns []string
+
+	// redactor is applied to the objects when they are printed or bundled, nil when --no-redact is set
+	redactor *Redactor
+)
+
+// AddRedactionFlags binds the redaction flags shared by all the commands
+func AddRedactionFlags(flags *pflag.FlagSet) {
+	flags.BoolVarP(&noRedact, "no-redact", "", false, "show the environment values, Secret data, tokens and credentials as is")
+	flags.StringArrayVarP(&redactPatterns, "redact-pattern", "", nil, "an additional regular expression to redact, the first submatch if any is kept in front and the second one after. Can be repeated")
+}
+
+// InitRedaction prepares the redactor from the redaction flags, it must run before any command
+func InitRedaction() error {
+	if noRedact {
+		redactor = nil
+		return nil
+	}
+	r, err := NewRedactor(redactPatterns)
+	if err != nil {
+		return err
+	}
+	redactor = r
+	return nil
+}
+
+// changedRedacted stands for a difference hidden by the redaction
+const changedRedacted = "changed (redacted)"
+
+// printable returns a view of sc for the printers, whose report is a redacted copy. The loaded objects
+// are kept as is, so that the diffs and the refreshes of --watch work on the real values.
+func (sc *ServingConfiguration) printable() *ServingConfiguration {
+	if sc.redactor == nil {
+		return sc
+	}
+	view := *sc
+	view.report = diagnosis.Redact(sc.report, sc.redactor)
+	return &view
+}
+
+// shownValues returns the redacted values of a difference found on the real values, or changedRedacted
+// when the redaction hides the difference
+func shownValues(redactedA, redactedB string) (string, string) {
+	if redactedA == redactedB {
+		return redactedA, changedRedacted
+	}
+	return redactedA, redactedB
+}
@@ -0,0 +1,254 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+
+	. "knative.dev/kn-plugin-diag/pkg/utils"
+)
+
+var (
+	revisionNamespace string
+	revisionService   string
+
+	ksvcGVR     = schema.GroupVersionResource{Group: "serving.knative.dev", Version: "v1", Resource: "services"}
+	revisionGVR = schema.GroupVersionResource{Group: "serving.knative.dev", Version: "v1", Resource: "revisions"}
+
+	// ignoredRevisionFields change with every revision and do not explain anything
+	ignoredRevisionFields = []string{
+		"metadata.annotations.serving.knative.dev/creator",
+		"metadata.annotations.serving.knative.dev/lastModifier",
+		"metadata.annotations.serving.knative.dev/routes",
+		"metadata.annotations.serving.knative.dev/routingStateModified",
+	}
+)
+
+// riskyChange describes a kind of revision change which commonly makes the new revision fail. The field
+// matches whole path segments of the flattened keys, so .image does not match .imagePullPolicy.
+type riskyChange struct {
+	field string
+	hint  string
+}
+
+var riskyChanges = []riskyChange{
+	{".image", "a new image may fail to pull or to start"},
+	{".command", "a new entrypoint may exit at startup"},
+	{".args", "new arguments may make the container exit at startup"},
+	{".readinessProbe", "a stricter readiness probe keeps the revision from becoming ready"},
+	{".livenessProbe", "a stricter liveness probe may restart the container in a loop"},
+	{".startupProbe", "a stricter startup probe may restart the container in a loop"},
+	{".ports", "the queue-proxy only reaches the container on the declared port"},
+	{".resources.limits", "lower limits may get the container OOMKilled or throttled"},
+	{".resources.requests", "higher requests may not fit in the nodes or in the namespace quota"},
+	{".envFrom", "a missing ConfigMap or Secret keeps the pods from starting"},
+	{".env", "a changed or missing environment variable may break the application"},
+	{".volumes", "a missing ConfigMap, Secret or PVC keeps the pods from starting"},
+	{".volumeMounts", "a missing volume keeps the pods from starting"},
+	{"spec.serviceAccountName", "the new service account may miss the pull secrets or permissions"},
+	{"spec.imagePullSecrets", "the image may fail to pull"},
+	{"spec.timeoutSeconds", "requests running longer than the timeout are cut"},
+	{"spec.containerConcurrency", "a lower concurrency needs more pods to serve the same load"},
+	{"autoscaling.knative.dev/min-scale", "the revision is only ready once min-scale pods are up"},
+	{"autoscaling.knative.dev/initial-scale", "the revision is only ready once initial-scale pods are up"},
+}
+
+// NewRevisionCmd represents the revision command
+func NewRevisionCmd(p *ConnectionConfig) *cobra.Command {
+	var revisionCmd = &cobra.Command{
+		Use:   "revision",
+		Short: "kn-diag revision",
+		Long:  `Inspect knative revisions.`,
+	}
+	revisionCmd.AddCommand(newRevisionDiffCmd(p))
+	return revisionCmd
+}
+
+func newRevisionDiffCmd(p *ConnectionConfig) *cobra.Command {
+	var diffCmd = &cobra.Command{
+		Use:   "diff",
+		Short: "kn-diag revision diff",
+		Long: `Compare the specs of two knative revisions. Without revision names, the latest ready revision
+of the service is compared to its latest created revision. For example
+kn-diag revision diff <revision-a> <revision-b>
+kn-diag revision diff --service <ksvc-name>`,
+
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 && (len(args) != 0 || revisionService == "") {
+				return fmt.Errorf(`'revision diff' requires two revision names or a knative service name.
+For example: kn-diag revision diff <revision-a> <revision-b> or kn-diag revision diff --service <ksvc-name>`)
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			Namespace := resolveNamespace(cmd, revisionNamespace, p)
+			dynClient, err := newDynamicClient(p)
+			if err != nil {
+				return err
+			}
+
+			names := args
+			if len(names) == 0 {
+				names, err = latestRevisionNames(cmd.Context(), dynClient, revisionService, Namespace)
+				if err != nil {
+					return err
+				}
+			}
+
+			revisions := make([]*unstructured.Unstructured, 2)
+			for i, name := range names {
+				revisions[i], err = dynClient.Resource(revisionGVR).Namespace(Namespace).Get(cmd.Context(), name, metav1.GetOptions{})
+				if err != nil {
+					return fmt.Errorf("Failed to load revision %s, %v", name, err)
+				}
+			}
+			return printRevisionDiff(names, revisions)
+		},
+	}
+
+	diffCmd.Flags().StringVarP(&revisionNamespace, "namespace", "n", "", "the target namespace")
+	diffCmd.Flags().StringVarP(&revisionService, "service", "", "", "compare the latest ready and latest created revisions of this knative service")
+	return diffCmd
+}
+
+// latestRevisionNames returns the latest ready and the latest created revision names of a ksvc
+func latestRevisionNames(ctx context.Context, dynClient dynamic.Interface, ksvcName, Namespace string) ([]string, error) {
+	ksvc, err := dynClient.Resource(ksvcGVR).Namespace(Namespace).Get(ctx, ksvcName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load ksvc %s, %v", ksvcName, err)
+	}
+	latestReady, _, _ := unstructured.NestedString(ksvc.Object, "status", "latestReadyRevisionName")
+	latestCreated, _, _ := unstructured.NestedString(ksvc.Object, "status", "latestCreatedRevisionName")
+	if latestReady == "" || latestCreated == "" {
+		return nil, fmt.Errorf("ksvc %s has no ready or no created revision to compare", ksvcName)
+	}
+	if latestReady == latestCreated {
+		return nil, fmt.Errorf("The latest created revision %s of ksvc %s is also the latest ready one, please name the revisions to compare", latestCreated, ksvcName)
+	}
+	return []string{latestReady, latestCreated}, nil
+}
+
+// printRevisionDiff compares the real fields of the revisions and shows the redacted ones
+func printRevisionDiff(names []string, revisions []*unstructured.Unstructured) error {
+	fieldsA, fieldsB := revisionFields(revisions[0]), revisionFields(revisions[1])
+	shownA, shownB := revisionFields(redactedRevision(revisions[0])), revisionFields(redactedRevision(revisions[1]))
+	c := color.New(color.FgRed).Add(color.Bold)
+
+	table := NewTable(os.Stdout, []string{"Field", names[0], names[1], "Note"})
+	table.SetSeperator(false)
+	changes := 0
+	for _, key := range unionKeys(fieldsA, fieldsB) {
+		if fieldsA[key] == fieldsB[key] || isIgnoredRevisionField(key) {
+			continue
+		}
+		changes++
+		note := ""
+		if hint, ok := riskyChangeHint(key); ok {
+			note = c.Sprintf("%s", hint)
+		}
+		valueA, valueB := shownValues(shownA[key], shownB[key])
+		table.Add([]string{key, valueA, valueB, note})
+	}
+	if changes == 0 {
+		fmt.Printf("No difference found between revision %s and %s\n", names[0], names[1])
+		return nil
+	}
+	table.Print()
+	return nil
+}
+
+func redactedRevision(revision *unstructured.Unstructured) *unstructured.Unstructured {
+	redacted := revision.DeepCopy()
+	redactor.RedactObject(redacted.Object)
+	return redacted
+}
+
+// revisionFields flattens the annotations and the spec of a revision into path and value pairs
+func revisionFields(revision *unstructured.Unstructured) map[string]string {
+	fields := make(map[string]string)
+	annotations, _, _ := unstructured.NestedMap(revision.Object, "metadata", "annotations")
+	flattenFields("metadata.annotations", annotations, fields)
+	spec, _, _ := unstructured.NestedMap(revision.Object, "spec")
+	flattenFields("spec", spec, fields)
+	return fields
+}
+
+// flattenFields keys the slice items by their name when they have one, e.g. containers[user-container].image,
+// so that reordering or adding an item does not show up as a change of all the following ones
+func flattenFields(prefix string, value interface{}, fields map[string]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, nested := range v {
+			flattenFields(prefix+"."+key, nested, fields)
+		}
+	case []interface{}:
+		for i, item := range v {
+			key := fmt.Sprintf("%d", i)
+			if m, ok := item.(map[string]interface{}); ok {
+				if name, ok := m["name"].(string); ok && name != "" {
+					key = name
+				}
+			}
+			flattenFields(fmt.Sprintf("%s[%s]", prefix, key), item, fields)
+		}
+	default:
+		fields[prefix] = fmt.Sprintf("%v", v)
+	}
+}
+
+func isIgnoredRevisionField(key string) bool {
+	for _, ignored := range ignoredRevisionFields {
+		if key == ignored {
+			return true
+		}
+	}
+	return false
+}
+
+func riskyChangeHint(key string) (string, bool) {
+	for _, risky := range riskyChanges {
+		if matchesField(key, risky.field) {
+			return risky.hint, true
+		}
+	}
+	return "", false
+}
+
+// matchesField tells whether the field occurs in the key followed by the end of a path segment
+func matchesField(key, field string) bool {
+	for offset := 0; ; {
+		i := strings.Index(key[offset:], field)
+		if i < 0 {
+			return false
+		}
+		end := offset + i + len(field)
+		if end == len(key) || key[end] == '.' || key[end] == '[' {
+			return true
+		}
+		offset += i + 1
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestRiskyChangeHint(t *testing.T) {
+	tests := []struct {
+		key   string
+		risky bool
+		hint  string
+	}{
+		{"spec.containers[user-container].image", true, "a new image may fail to pull or to start"},
+		{"spec.containers[user-container].imagePullPolicy", false, ""},
+		{"spec.containers[user-container].env[TARGET].value", true, "a changed or missing environment variable may break the application"},
+		{"spec.containers[user-container].envFrom[0].configMapRef.name", true, "a missing ConfigMap or Secret keeps the pods from starting"},
+		{"spec.containers[user-container].resources.limits.memory", true, "lower limits may get the container OOMKilled or throttled"},
+		{"spec.imagePullSecrets[regcred].name", true, "the image may fail to pull"},
+		{"metadata.annotations.autoscaling.knative.dev/min-scale", true, "the revision is only ready once min-scale pods are up"},
+		{"metadata.annotations.autoscaling.knative.dev/min-scale-extra", false, ""},
+		{"metadata.labels.app", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			hint, risky := riskyChangeHint(tt.key)
+			assert.Equal(t, risky, tt.risky)
+			assert.Equal(t, hint, tt.hint)
+		})
+	}
+}
+
+func TestFlattenFields(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  map[string]string
+	}{
+		{
+			name:  "nested maps",
+			value: map[string]interface{}{"timeoutSeconds": int64(300), "metadata": map[string]interface{}{"name": "hello"}},
+			want:  map[string]string{"spec.timeoutSeconds": "300", "spec.metadata.name": "hello"},
+		},
+		{
+			name: "items keyed by name",
+			value: map[string]interface{}{"containers": []interface{}{
+				map[string]interface{}{"name": "user-container", "image": "hello:v1"},
+				map[string]interface{}{"name": "sidecar", "image": "proxy:v2"},
+			}},
+			want: map[string]string{
+				"spec.containers[user-container].name":  "user-container",
+				"spec.containers[user-container].image": "hello:v1",
+				"spec.containers[sidecar].name":         "sidecar",
+				"spec.containers[sidecar].image":        "proxy:v2",
+			},
+		},
+		{
+			name:  "items without name keyed by index",
+			value: map[string]interface{}{"args": []interface{}{"--port", "8080"}},
+			want:  map[string]string{"spec.args[0]": "--port", "spec.args[1]": "8080"},
+		},
+		{
+			name:  "empty name keyed by index",
+			value: map[string]interface{}{"ports": []interface{}{map[string]interface{}{"name": "", "containerPort": int64(8080)}}},
+			want:  map[string]string{"spec.ports[0].name": "", "spec.ports[0].containerPort": "8080"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields := map[string]string{}
+			flattenFields("spec", tt.value, fields)
+			assert.DeepEqual(t, fields, tt.want)
+		})
+	}
+}
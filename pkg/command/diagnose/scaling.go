@@ -0,0 +1,282 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"knative.dev/pkg/kmap"
+	"knative.dev/serving/pkg/apis/autoscaling"
+	autoscalerconfig "knative.dev/serving/pkg/autoscaler/config"
+	asconfig "knative.dev/serving/pkg/autoscaler/config/autoscalerconfig"
+
+	. "knative.dev/kn-plugin-diag/pkg/models"
+	. "knative.dev/kn-plugin-diag/pkg/utils"
+)
+
+var explainScaling bool
+
+// scalingSetting is the effective value of an autoscaling knob and where it comes from
+type scalingSetting struct {
+	name   string
+	value  string
+	source string
+}
+
+// scalingExplanation is the effective autoscaling configuration of a revision and why it is at its current scale
+type scalingExplanation struct {
+	revision string
+	settings []scalingSetting
+	notes    []string
+}
+
+// printScalingExplanation prints the effective autoscaling settings of every revision of the tree and
+// explains the current scale and the KPA/SKS mode
+func printScalingExplanation(sc *ServingConfiguration) {
+	data, config := sc.loadAutoscalerConfig()
+	for _, revision := range findReportNodes(sc.report.Root, "revision") {
+		explanation := explainRevisionScaling(revision, data, config)
+		fmt.Printf("\nScaling of revision %s\n", explanation.revision)
+		table := NewTable(os.Stdout, []string{"Setting", "Value", "Source"})
+		table.SetSeperator(false)
+		for _, setting := range explanation.settings {
+			table.Add([]string{setting.name, setting.value, setting.source})
+		}
+		table.Print()
+		for _, note := range explanation.notes {
+			fmt.Printf("* %s\n", note)
+		}
+	}
+}
+
+// loadAutoscalerConfig returns the data of config-autoscaler and the parsed configuration, which falls back
+// to the defaults of Knative Serving when the ConfigMap can not be loaded or parsed
+func (sc *ServingConfiguration) loadAutoscalerConfig() (map[string]string, *asconfig.Config) {
+	data := sc.loadServingConfigMap(autoscalerconfig.ConfigName)
+	config, err := autoscalerconfig.NewConfigFromMap(data)
+	if err != nil {
+		sc.warn("Invalid configmap %s/%s, the defaults of Knative Serving are used, %v\n", servingNamespace, autoscalerconfig.ConfigName, err)
+		data = map[string]string{}
+		config, _ = autoscalerconfig.NewConfigFromMap(data)
+	}
+	return data, config
+}
+
+// loadServingConfigMap returns the data of a ConfigMap of knative-serving, which is empty when it can not be loaded
+func (sc *ServingConfiguration) loadServingConfigMap(name string) map[string]string {
+	cm, err := sc.dynClient.Resource(configMapsGVR).Namespace(servingNamespace).Get(sc.ctx, name, metav1.GetOptions{})
+	if err != nil {
+		sc.warn("Failed to load configmap %s/%s, the defaults of Knative Serving are used, %v\n", servingNamespace, name, err)
+		return map[string]string{}
+	}
+	data, _, _ := unstructured.NestedStringMap(cm.Object, "data")
+	if data == nil {
+		data = map[string]string{}
+	}
+	return data
+}
+
+// explainRevisionScaling merges the config-autoscaler defaults with the autoscaling annotations of the revision,
+// the annotations win like in the autoscaler
+func explainRevisionScaling(revision *ReportNode, data map[string]string, config *asconfig.Config) scalingExplanation {
+	annotations := revision.Object.GetAnnotations()
+	explanation := scalingExplanation{revision: revision.Name}
+	add := func(setting scalingSetting) string {
+		explanation.settings = append(explanation.settings, setting)
+		return setting.value
+	}
+
+	class := add(effectiveSetting("class", annotations, autoscaling.ClassAnnotation, data, "pod-autoscaler-class", config.PodAutoscalerClass))
+	defaultMetric := autoscaling.Concurrency
+	if class == autoscaling.HPA {
+		defaultMetric = autoscaling.CPU
+	}
+	metric := add(effectiveSetting("metric", annotations, autoscaling.MetricAnnotation, nil, "", defaultMetric))
+	minScale := add(effectiveSetting("min-scale", annotations, autoscaling.MinScaleAnnotation, data, "min-scale", strconv.Itoa(int(config.MinScale))))
+	maxScale := add(effectiveSetting("max-scale", annotations, autoscaling.MaxScaleAnnotation, data, "max-scale", strconv.Itoa(int(config.MaxScale))))
+	add(effectiveSetting("initial-scale", annotations, autoscaling.InitialScaleAnnotation, data, "initial-scale", strconv.Itoa(int(config.InitialScale))))
+	add(effectiveSetting("activation-scale", annotations, autoscaling.ActivationScale, nil, "", "1"))
+	add(targetSetting(revision, annotations, metric, data, config))
+	add(effectiveSetting("target-utilization-percentage", annotations, autoscaling.TargetUtilizationPercentageAnnotation, data,
+		"container-concurrency-target-percentage", strconv.FormatFloat(config.ContainerConcurrencyTargetFraction*100, 'f', -1, 64)))
+	window := add(effectiveSetting("window", annotations, autoscaling.WindowAnnotation, data, "stable-window", config.StableWindow.String()))
+	tbc := add(effectiveSetting("target-burst-capacity", annotations, autoscaling.TargetBurstCapacityAnnotation, data,
+		"target-burst-capacity", strconv.FormatFloat(config.TargetBurstCapacity, 'f', -1, 64)))
+	add(effectiveSetting("enable-scale-to-zero", nil, nil, data, "enable-scale-to-zero", strconv.FormatBool(config.EnableScaleToZero)))
+	add(effectiveSetting("scale-to-zero-grace-period", nil, nil, data, "scale-to-zero-grace-period", config.ScaleToZeroGracePeriod.String()))
+	retention := add(effectiveSetting("scale-to-zero-pod-retention-period", annotations, autoscaling.ScaleToZeroPodRetentionPeriodAnnotation, data,
+		"scale-to-zero-pod-retention-period", config.ScaleToZeroPodRetentionPeriod.String()))
+	add(effectiveSetting("scale-down-delay", annotations, autoscaling.ScaleDownDelayAnnotation, data, "scale-down-delay", config.ScaleDownDelay.String()))
+
+	kpa := firstReportNode(revision, "kpa")
+	sks := firstReportNode(kpa, "sks")
+	explanation.notes = scalingNotes(kpa, sks, scalingKnobs{
+		class:       class,
+		minScale:    atoi(minScale),
+		maxScale:    atoi(maxScale),
+		window:      window,
+		tbc:         tbc,
+		scaleToZero: config.EnableScaleToZero,
+		grace:       config.ScaleToZeroGracePeriod,
+		retention:   retention,
+	})
+	return explanation
+}
+
+// effectiveSetting returns the value of the annotation if set, otherwise the value of config-autoscaler,
+// which is the default of Knative Serving when the key is not in the ConfigMap
+func effectiveSetting(name string, annotations map[string]string, annotation kmap.KeyPriority, data map[string]string, key, configValue string) scalingSetting {
+	if annotation != nil {
+		if k, v, ok := annotation.Get(annotations); ok {
+			return scalingSetting{name: name, value: v, source: "annotation " + k}
+		}
+	}
+	if _, ok := data[key]; ok {
+		return scalingSetting{name: name, value: configValue, source: autoscalerconfig.ConfigName + " " + key}
+	}
+	return scalingSetting{name: name, value: configValue, source: "default"}
+}
+
+// targetSetting resolves the target per pod, a hard containerConcurrency limit is the concurrency target
+// unless the target annotation is set
+func targetSetting(revision *ReportNode, annotations map[string]string, metric string, data map[string]string, config *asconfig.Config) scalingSetting {
+	if k, v, ok := autoscaling.TargetAnnotation.Get(annotations); ok {
+		return scalingSetting{name: "target", value: v, source: "annotation " + k}
+	}
+	switch metric {
+	case autoscaling.RPS:
+		return effectiveSetting("target", nil, nil, data, "requests-per-second-target-default", strconv.FormatFloat(config.RPSTargetDefault, 'f', -1, 64))
+	case autoscaling.Concurrency:
+		if cc, ok, _ := unstructured.NestedInt64(revision.Object.Object, "spec", "containerConcurrency"); ok && cc > 0 {
+			return scalingSetting{name: "target", value: strconv.FormatInt(cc, 10), source: "revision spec.containerConcurrency"}
+		}
+		return effectiveSetting("target", nil, nil, data, "container-concurrency-target-default", strconv.FormatFloat(config.ContainerConcurrencyTargetDefault, 'f', -1, 64))
+	}
+	return scalingSetting{name: "target", value: "<none>", source: "set by the target annotation only"}
+}
+
+// scalingKnobs are the effective settings which explain the current scale
+type scalingKnobs struct {
+	class       string
+	minScale    int
+	maxScale    int
+	window      string
+	tbc         string
+	scaleToZero bool
+	grace       time.Duration
+	retention   string
+}
+
+// scalingNotes explains the current scale of the revision from the status of its PodAutoscaler and SKS
+func scalingNotes(kpa, sks *ReportNode, knobs scalingKnobs) []string {
+	notes := []string{}
+	if kpa == nil {
+		return append(notes, "No PodAutoscaler found for the revision, the scale can not be explained")
+	}
+	desired, hasDesired, _ := unstructured.NestedInt64(kpa.Object.Object, "status", "desiredScale")
+	actual, _, _ := unstructured.NestedInt64(kpa.Object.Object, "status", "actualScale")
+	if hasDesired {
+		notes = append(notes, fmt.Sprintf("The autoscaler wants %d pods, %d are ready", desired, actual))
+	}
+
+	active := conditionOf(kpa.Object, "Active")
+	switch {
+	case hasDesired && desired == 0:
+		reason := "no request was received"
+		if active != nil && stringValue(active["reason"]) != "" {
+			reason = fmt.Sprintf("%s: %s", stringValue(active["reason"]), stringValue(active["message"]))
+		}
+		notes = append(notes, fmt.Sprintf("The revision is scaled to zero (%s), the activator receives the next request and scales it up", reason))
+	case knobs.class == autoscaling.HPA:
+		notes = append(notes, "The revision is scaled by a HorizontalPodAutoscaler, which never scales to zero")
+		if hpa := firstReportNode(kpa, "hpa"); hpa != nil {
+			notes = append(notes, "The HorizontalPodAutoscaler has "+hpaSummary(hpa.Object))
+		}
+	case !knobs.scaleToZero:
+		notes = append(notes, "The revision does not scale to zero, enable-scale-to-zero is false in config-autoscaler")
+	case knobs.minScale > 0:
+		notes = append(notes, fmt.Sprintf("The revision does not scale to zero, min-scale keeps at least %d pods", knobs.minScale))
+	default:
+		notes = append(notes, fmt.Sprintf("The revision scales to zero after a stable window of %s without requests, the last pod is kept for the scale-to-zero-pod-retention-period %s and at most the scale-to-zero-grace-period %s while the activator is put in the path",
+			knobs.window, knobs.retention, knobs.grace))
+	}
+	if knobs.maxScale > 0 && actual >= int64(knobs.maxScale) {
+		notes = append(notes, fmt.Sprintf("The revision is at max-scale %d and does not scale further up", knobs.maxScale))
+	}
+	if hasDesired && desired > actual {
+		notes = append(notes, fmt.Sprintf("%d more pods are desired than ready, see the deployment and the pods of the revision", desired-actual))
+	}
+
+	if sks == nil {
+		return append(notes, "No ServerlessService found for the revision, the request path can not be explained")
+	}
+	mode, _, _ := unstructured.NestedString(sks.Object.Object, "spec", "mode")
+	switch {
+	case mode == "Proxy" && (!hasDesired || desired == 0 || actual == 0):
+		notes = append(notes, "The SKS is in Proxy mode: the requests go through the activator, which buffers them while there is no ready pod")
+	case mode == "Proxy" && knobs.tbc == "-1":
+		notes = append(notes, "The SKS is in Proxy mode: target-burst-capacity is -1, so the activator always stays in the request path")
+	case mode == "Proxy":
+		notes = append(notes, fmt.Sprintf("The SKS is in Proxy mode: the spare capacity of the ready pods is below the target-burst-capacity %s, the activator stays in the request path to absorb bursts", knobs.tbc))
+	case mode == "Serve" && knobs.class == autoscaling.HPA:
+		notes = append(notes, "The SKS is in Serve mode: the requests go directly to the pods, the activator is not used by the hpa class")
+	case mode == "Serve" && knobs.tbc == "0":
+		notes = append(notes, "The SKS is in Serve mode: target-burst-capacity is 0, the activator is only in the request path at zero")
+	case mode == "Serve":
+		notes = append(notes, fmt.Sprintf("The SKS is in Serve mode: the spare capacity of the ready pods covers the target-burst-capacity %s, the requests go directly to the pods", knobs.tbc))
+	default:
+		notes = append(notes, fmt.Sprintf("The SKS has the unknown mode %q", mode))
+	}
+	return notes
+}
+
+// firstReportNode returns the first node of crName below node
+func firstReportNode(node *ReportNode, crName string) *ReportNode {
+	if node == nil {
+		return nil
+	}
+	for _, leaf := range node.Children {
+		if leaf.Type == crName {
+			return leaf
+		}
+		if found := firstReportNode(leaf, crName); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// conditionOf returns the condition of the given type of the object
+func conditionOf(object *unstructured.Unstructured, conditionType string) map[string]interface{} {
+	conditions, _, _ := unstructured.NestedSlice(object.Object, "status", "conditions")
+	for _, condition := range conditions {
+		if m, ok := condition.(map[string]interface{}); ok && stringValue(m["type"]) == conditionType {
+			return m
+		}
+	}
+	return nil
+}
+
+func atoi(s string) int {
+	i, _ := strconv.Atoi(s)
+	return i
+}
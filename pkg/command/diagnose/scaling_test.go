@@ -0,0 +1,140 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/fake"
+
+	. "knative.dev/kn-plugin-diag/pkg/models"
+)
+
+func TestExplainRevisionScaling(t *testing.T) {
+	revision := func(annotations map[string]string) *ReportNode {
+		object := &unstructured.Unstructured{Object: map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "hello-00001", "namespace": "demo"},
+		}}
+		object.SetAnnotations(annotations)
+		kpa := &unstructured.Unstructured{Object: map[string]interface{}{
+			"status": map[string]interface{}{"desiredScale": int64(1), "actualScale": int64(1)},
+		}}
+		return &ReportNode{Type: "revision", Name: "hello-00001", Object: object, Children: []*ReportNode{
+			{Type: "kpa", Name: "hello-00001", Object: kpa},
+		}}
+	}
+	tests := []struct {
+		name        string
+		configMap   map[string]interface{}
+		annotations map[string]string
+		want        map[string]scalingSetting
+		wantNote    string
+	}{
+		{
+			name: "defaults without config-autoscaler",
+			want: map[string]scalingSetting{
+				"class":     {"class", "kpa.autoscaling.knative.dev", "default"},
+				"metric":    {"metric", "concurrency", "default"},
+				"target":    {"target", "100", "default"},
+				"min-scale": {"min-scale", "0", "default"},
+			},
+			wantNote: "The revision scales to zero after a stable window of 1m0s",
+		},
+		{
+			name:      "config-autoscaler overrides the defaults",
+			configMap: map[string]interface{}{"container-concurrency-target-default": "50", "min-scale": "1"},
+			want: map[string]scalingSetting{
+				"target":    {"target", "50", "config-autoscaler container-concurrency-target-default"},
+				"min-scale": {"min-scale", "1", "config-autoscaler min-scale"},
+				"window":    {"window", "1m0s", "default"},
+			},
+			wantNote: "The revision does not scale to zero, min-scale keeps at least 1 pods",
+		},
+		{
+			name:        "annotations override config-autoscaler",
+			configMap:   map[string]interface{}{"container-concurrency-target-default": "50", "min-scale": "1"},
+			annotations: map[string]string{"autoscaling.knative.dev/target": "10", "autoscaling.knative.dev/min-scale": "2"},
+			want: map[string]scalingSetting{
+				"target":    {"target", "10", "annotation autoscaling.knative.dev/target"},
+				"min-scale": {"min-scale", "2", "annotation autoscaling.knative.dev/min-scale"},
+			},
+			wantNote: "The revision does not scale to zero, min-scale keeps at least 2 pods",
+		},
+		{
+			name:      "invalid config-autoscaler falls back to the defaults",
+			configMap: map[string]interface{}{"container-concurrency-target-default": "fifty", "min-scale": "1"},
+			want: map[string]scalingSetting{
+				"target":    {"target", "100", "default"},
+				"min-scale": {"min-scale", "0", "default"},
+			},
+			wantNote: "The revision scales to zero after a stable window of 1m0s",
+		},
+		{
+			name:        "hpa class",
+			annotations: map[string]string{"autoscaling.knative.dev/class": "hpa.autoscaling.knative.dev"},
+			want: map[string]scalingSetting{
+				"class":  {"class", "hpa.autoscaling.knative.dev", "annotation autoscaling.knative.dev/class"},
+				"metric": {"metric", "cpu", "default"},
+				"target": {"target", "<none>", "set by the target annotation only"},
+			},
+			wantNote: "The revision is scaled by a HorizontalPodAutoscaler, which never scales to zero",
+		},
+		{
+			name:        "kpa class with the rps metric",
+			annotations: map[string]string{"autoscaling.knative.dev/class": "kpa.autoscaling.knative.dev", "autoscaling.knative.dev/metric": "rps"},
+			want: map[string]scalingSetting{
+				"class":  {"class", "kpa.autoscaling.knative.dev", "annotation autoscaling.knative.dev/class"},
+				"metric": {"metric", "rps", "annotation autoscaling.knative.dev/metric"},
+				"target": {"target", "200", "default"},
+			},
+			wantNote: "The revision scales to zero after a stable window of 1m0s",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects := []runtime.Object{}
+			if tt.configMap != nil {
+				objects = append(objects, &unstructured.Unstructured{Object: map[string]interface{}{
+					"apiVersion": "v1",
+					"kind":       "ConfigMap",
+					"metadata":   map[string]interface{}{"name": "config-autoscaler", "namespace": servingNamespace},
+					"data":       tt.configMap,
+				}})
+			}
+			sc := newServingConfiguration("hello", "demo", fake.NewSimpleDynamicClient(runtime.NewScheme(), objects...), nil)
+			data, config := sc.loadAutoscalerConfig()
+
+			explanation := explainRevisionScaling(revision(tt.annotations), data, config)
+			settings := make(map[string]scalingSetting)
+			for _, setting := range explanation.settings {
+				settings[setting.name] = setting
+			}
+			for name, want := range tt.want {
+				assert.Equal(t, settings[name], want, name)
+			}
+			found := false
+			for _, note := range explanation.notes {
+				found = found || strings.HasPrefix(note, tt.wantNote)
+			}
+			assert.Assert(t, found, "%q not in %v", tt.wantNote, explanation.notes)
+		})
+	}
+}
@@ -19,17 +19,28 @@ package diagnose
 import (
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
 
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"knative.dev/kn-plugin-diag/pkg/diagnosis"
 	. "knative.dev/kn-plugin-diag/pkg/utils"
 
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 )
 
 var (
-	n       string
-	verbose string
+	n             string
+	allNamespaces bool
+	verbose       string
+	watch         bool
+	bundle        string
+	timeline      bool
+
+	fromBundle string
+	fromDir    string
 )
 
 // domainCmd represents the domain command
@@ -38,53 +49,223 @@ func NewServiceCmd(p *ConnectionConfig) *cobra.Command {
 		Use:   "service",
 		Short: "kn-diag service",
 		Long: `Query knative service details. For example
-kn-diag service <ksvc-name>`,
+kn-diag service <ksvc-name>
+kn-diag service <ksvc-name> <ksvc-name>...`,
 
 		PreRunE: func(cmd *cobra.Command, args []string) error {
 			if len(args) == 0 {
 				return fmt.Errorf(`'service' requires a input arguments for knative servie name.
 For example: kn-diag service <ksvc-name> -ns <namespace>`)
 			}
+			if allNamespaces && cmd.Flags().Changed("namespace") {
+				return fmt.Errorf("-n and -A can not be used together")
+			}
+			if len(args) > 1 && (watch || bundle != "" || timeline) {
+				return fmt.Errorf("--watch, --bundle and --timeline can only be used with a single knative service")
+			}
+			//a bad --output fails before the resources are fetched
+			if _, err := parseOutputFormat(output); err != nil {
+				return err
+			}
+			if output != "" && strings.ToLower(verbose) == "keyinfo" {
+				return fmt.Errorf("--output can not be used with --verbose keyinfo")
+			}
 			return nil
 
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			ksvcName := args[0]
-			Namespace := "default"
-			if cmd.Flags().Changed("namespace") {
-				Namespace = n
+			dynClient, Namespace, err := loadDynamicClient(cmd, resolveNamespace(cmd, n, p), p)
+			if err != nil {
+				return err
+			}
+			namespaces := make([]string, len(args))
+			for i, ksvcName := range args {
+				namespaces[i] = Namespace
+				if allNamespaces {
+					namespaces[i], err = findServiceNamespace(cmd.Context(), dynClient, ksvcName)
+					if err != nil {
+						return err
+					}
+				}
+			}
+			if len(args) > 1 {
+				return dumpServicesToTables(args, namespaces, dynClient, strings.ToLower(verbose))
 			}
-			sc, err := NewServingConfiguration(ksvcName, Namespace, p)
+			sc, err := newServingConfigurationForClient(args[0], namespaces[0], dynClient)
 			if err != nil {
 				return err
 			}
-			err = dumpToTables(sc, strings.ToLower(verbose))
+			if bundle != "" {
+				if err := writeBundle(cmd.Context(), sc, p.ClientSet, bundle); err != nil {
+					return err
+				}
+				defer SayMessage("Diagnostic bundle is written to ", bundle)
+			}
+			//the printers get redacted copies of the objects, the watch refreshes the real ones
+			view := sc.printable()
+			if timeline {
+				return printTimeline(cmd.Context(), view)
+			}
+			if watch {
+				ctx, cancel := signal.NotifyContext(cmd.Context(), os.Interrupt)
+				defer cancel()
+				return watchServing(ctx, sc, strings.ToLower(verbose))
+			}
+			err = dumpToTables(view, strings.ToLower(verbose))
 			if err != nil {
 				return err
 			}
+			if explainScaling {
+				printScalingExplanation(view)
+			}
+			if checkFeatures {
+				printFeatureCheck(view)
+			}
+			if explainURL {
+				printURLExplanation(view)
+			}
+			if explainImage {
+				printImageExplanation(view)
+			}
+			if checkQuota {
+				printQuotaCheck(view)
+			}
 			return nil
 		},
 	}
 
 	serviceCmd.Flags().StringVarP(&n, "namespace", "n", "", "the target namespace")
+	serviceCmd.Flags().BoolVarP(&allNamespaces, "all-namespaces", "A", false, "find the knative service by name across all the namespaces")
+	serviceCmd.Flags().StringVarP(&output, "output", "o", "", "the columns of the default view: wide, or custom-columns=[TYPE:]HEADER:JSONPATH,... evaluated on every resource, or only on the resources of TYPE, e.g. revision:IMAGE:.spec.containers[0].image. <none> where the field is missing")
 	serviceCmd.Flags().StringVarP(&verbose, "verbose", "", "", "enable verbose output. Supported value: keyinfo")
+	serviceCmd.Flags().StringVarP(&bundle, "bundle", "", "", "write the fetched objects, events, logs and Serving configuration to a tar.gz file for support")
+	serviceCmd.Flags().BoolVarP(&watch, "watch", "w", false, "watch the resources and redraw the output on every change")
+	serviceCmd.Flags().BoolVarP(&timeline, "timeline", "", false, "show the condition transitions, events and pod state changes of the tree sorted by time")
+	serviceCmd.Flags().StringVarP(&fromBundle, "from-bundle", "", "", "diagnose offline from a bundle written by --bundle instead of the cluster")
+	serviceCmd.Flags().StringVarP(&fromDir, "from-dir", "", "", "diagnose offline from the YAML or JSON dumps in a directory instead of the cluster")
+	serviceCmd.Flags().IntVarP(&maxPods, "max-pods", "", 10, "the maximum number of unhealthy pods shown in detail under a replicaset, the others are only counted")
+	serviceCmd.Flags().BoolVarP(&history, "history", "", false, "include the replicasets scaled down to 0, with their deployment revision and why they were scaled down")
+	serviceCmd.Flags().BoolVarP(&explainScaling, "explain-scaling", "", false, "explain the effective autoscaling settings of the revisions, merged from config-autoscaler and the annotations, and why they are at their current scale")
+	serviceCmd.Flags().BoolVarP(&checkFeatures, "check-features", "", false, "check the fields of the ksvc template gated by config-features against the feature flags")
+	serviceCmd.Flags().BoolVarP(&explainURL, "explain-url", "", false, "explain how the URL of the route is computed from config-domain, config-network and the visibility label, and compare it to status.url and the kingress hosts")
+	serviceCmd.Flags().StringVarP(&clusterDomain, "cluster-domain", "", "", "the cluster domain used by --explain-url, e.g. cluster.local, defaults to the one of status.address.url of the route")
+	serviceCmd.Flags().BoolVarP(&explainImage, "explain-image", "", false, "explain how the images of the revisions are resolved to digests and compare the digests to the ones run by the pods")
+	serviceCmd.Flags().BoolVarP(&checkQuota, "check-quota", "", false, "check the requests and limits of the pods of the revisions, queue-proxy included, against the ResourceQuotas and LimitRanges of the namespace")
 	return serviceCmd
 }
 
+// NeedsCluster tells whether the command queries the cluster. The help, the diagnoses reading a bundle
+// or a directory and the diffs of two files run without a kubeconfig.
+func NeedsCluster(cmd *cobra.Command, args []string) bool {
+	switch {
+	case cmd.Name() == "help", fromBundle != "" || fromDir != "":
+		return false
+	case cmd.Name() == "diff" && cmd.Parent() == cmd.Root():
+		for _, arg := range args {
+			if arg == liveSource {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// loadDynamicClient returns the client of the cluster, or an offline client serving the objects of files.
+// A bundle knows which namespace it was captured in, which is returned unless -n is set.
+func loadDynamicClient(cmd *cobra.Command, Namespace string, p *ConnectionConfig) (dynamic.Interface, string, error) {
+	if fromBundle == "" && fromDir == "" {
+		dynClient, err := newDynamicClient(p)
+		return dynClient, Namespace, err
+	}
+	if fromBundle != "" && fromDir != "" {
+		return nil, "", fmt.Errorf("--from-bundle and --from-dir can not be used together")
+	}
+	if watch || bundle != "" {
+		return nil, "", fmt.Errorf("--watch and --bundle require a cluster, they can not be used with --from-bundle or --from-dir")
+	}
+
+	var objects []*unstructured.Unstructured
+	var err error
+	if fromBundle != "" {
+		var manifest *BundleManifest
+		objects, manifest, err = loadBundle(fromBundle)
+		if err != nil {
+			return nil, "", err
+		}
+		if !cmd.Flags().Changed("namespace") && manifest.Namespace != "" {
+			Namespace = manifest.Namespace
+		}
+	} else {
+		objects, err = loadDir(fromDir)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	dynClient, err := newOfflineDynamicClient(objects, Namespace)
+	if err != nil {
+		return nil, "", err
+	}
+	return dynClient, Namespace, nil
+}
+
+// dumpServicesToTables diagnoses several services, each of them in the namespace at the same index. The objects
+// are listed once per resource type and namespace into a shared cache, so the number of API calls does not grow
+// with the number of services.
+func dumpServicesToTables(ksvcNames, namespaces []string, dynClient dynamic.Interface, verbose string) error {
+	cache := diagnosis.NewCache(dynClient)
+	for i, ksvcName := range ksvcNames {
+		sc := newServingConfiguration(ksvcName, namespaces[i], dynClient, cache)
+		if err := sc.load(); err != nil {
+			return err
+		}
+		view := sc.printable()
+		if i > 0 {
+			fmt.Println()
+		}
+		if err := dumpToTables(view, verbose); err != nil {
+			return err
+		}
+		if explainScaling {
+			printScalingExplanation(view)
+		}
+		if checkFeatures {
+			printFeatureCheck(view)
+		}
+		if explainURL {
+			printURLExplanation(view)
+		}
+		if explainImage {
+			printImageExplanation(view)
+		}
+		if checkQuota {
+			printQuotaCheck(view)
+		}
+	}
+	return nil
+}
+
 func dumpToTables(sc *ServingConfiguration, verbose string) error {
 
 	var table Table
 
+	format, err := parseOutputFormat(output)
+	if err != nil {
+		return err
+	}
+	sc.output = format
+
 	switch strings.ToLower(verbose) {
 	case "keyinfo":
 		table = NewTable(os.Stdout, []string{"Resource Type", "Name", "KeyInfo"})
 	default:
-		table = NewTable(os.Stdout, []string{"Resource Type", "Name", "Created At", "Status.Condition"})
+		table = NewTable(os.Stdout, format.headers())
 	}
 
 	defer table.Print()
 
-	err := sc.deepFirstRetrieveObjects(sc.objectRoot, 0, table, verbose)
+	err = sc.deepFirstRetrieveObjects(sc.report.Root, 0, table, verbose)
 	if err != nil {
 		return err
 	}
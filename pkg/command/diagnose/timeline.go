@@ -0,0 +1,240 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	. "knative.dev/kn-plugin-diag/pkg/models"
+	. "knative.dev/kn-plugin-diag/pkg/utils"
+)
+
+// timelineEntry is a single dated change of an object of the tree
+type timelineEntry struct {
+	at         time.Time
+	crName     string
+	objectName string
+	source     string
+	detail     string
+	failed     bool
+}
+
+// printTimeline merges the condition transitions, the events and the pod state changes of
+// the tree into a single list sorted by time, with the offset to the first change
+func printTimeline(ctx context.Context, sc *ServingConfiguration) error {
+	events, err := sc.relatedEvents(ctx)
+	if err != nil {
+		SayWarningMessage("Failed to load events of namespace %s, %v\n", sc.Namespace, err)
+	}
+	entries := mergeTimeline(sc.report.Root, events)
+	if len(entries) == 0 {
+		fmt.Printf("No dated change found for ksvc %s in namespace %s\n", sc.ksvcName, sc.Namespace)
+		return nil
+	}
+
+	c := color.New(color.FgRed).Add(color.Bold)
+	table := NewTable(os.Stdout, []string{"Time", "Offset", "Resource Type", "Name", "Source", "Detail"})
+	table.SetSeperator(false)
+	first := entries[0].at
+	for _, entry := range entries {
+		detail := entry.detail
+		if entry.failed {
+			detail = c.Sprintf("%s", detail)
+		}
+		table.Add([]string{
+			entry.at.Format(time.RFC3339),
+			"+" + entry.at.Sub(first).String(),
+			entry.crName,
+			entry.objectName,
+			entry.source,
+			detail,
+		})
+	}
+	table.Print()
+	return nil
+}
+
+// mergeTimeline returns the entries of the tree and of the events sorted by time, the entries at the same time
+// keep the order of the tree
+func mergeTimeline(root *ReportNode, events []unstructured.Unstructured) []timelineEntry {
+	entries := timelineEntries(root)
+	for _, event := range events {
+		if entry, ok := eventTimelineEntry(event); ok {
+			entries = append(entries, entry)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].at.Before(entries[j].at)
+	})
+	return entries
+}
+
+// timelineEntries collects the condition transitions and the pod state changes of the tree
+func timelineEntries(node *ReportNode) []timelineEntry {
+	if node == nil {
+		return nil
+	}
+
+	entries := []timelineEntry{}
+	for _, condition := range node.Conditions {
+		at, ok := parseTime(condition.LastTransitionTime)
+		if !ok {
+			continue
+		}
+		entries = append(entries, timelineEntry{
+			at:         at,
+			crName:     node.Type,
+			objectName: node.Name,
+			source:     "condition",
+			detail:     JoinNonEmpty(" ", condition.Type+"="+condition.Status, condition.Reason, condition.Message),
+			failed:     !condition.AsExpected,
+		})
+	}
+	if node.Object != nil {
+		if node.Type == "pod" {
+			entries = append(entries, podTimelineEntries(node)...)
+		}
+	}
+
+	for _, leaf := range node.Children {
+		entries = append(entries, timelineEntries(leaf)...)
+	}
+	return entries
+}
+
+// podTimelineEntries reports when the pod started and when its containers started or terminated
+func podTimelineEntries(node *ReportNode) []timelineEntry {
+	entries := []timelineEntry{}
+	newEntry := func(at time.Time, detail string, failed bool) timelineEntry {
+		return timelineEntry{
+			at:         at,
+			crName:     node.Type,
+			objectName: node.Name,
+			source:     "pod",
+			detail:     detail,
+			failed:     failed,
+		}
+	}
+
+	if startTime, ok := parseTime(unstructuredValue(node.Object.Object, "status", "startTime")); ok {
+		entries = append(entries, newEntry(startTime, "pod started", false))
+	}
+
+	statuses, _, _ := unstructured.NestedSlice(node.Object.Object, "status", "containerStatuses")
+	for _, status := range statuses {
+		m, ok := status.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		container := fmt.Sprintf("container %v", m["name"])
+		for _, stateKey := range []string{"lastState", "state"} {
+			if at, ok := parseTime(unstructuredValue(m, stateKey, "running", "startedAt")); ok {
+				entries = append(entries, newEntry(at, container+" running", false))
+			}
+			terminated, ok, _ := unstructured.NestedMap(m, stateKey, "terminated")
+			if !ok {
+				continue
+			}
+			if at, ok := parseTime(terminated["startedAt"]); ok {
+				entries = append(entries, newEntry(at, container+" started", false))
+			}
+			if at, ok := parseTime(terminated["finishedAt"]); ok {
+				exitCode := stringValue(terminated["exitCode"])
+				entries = append(entries, newEntry(at,
+					JoinNonEmpty(" ", container+" terminated", stringValue(terminated["reason"]), "exit code "+exitCode),
+					exitCode != "0"))
+			}
+		}
+	}
+	return entries
+}
+
+// eventTimelineEntry dates an event by its last occurrence, the first one of an event without lastTimestamp
+func eventTimelineEntry(event unstructured.Unstructured) (timelineEntry, bool) {
+	at, ok := parseTime(event.Object["lastTimestamp"])
+	if !ok {
+		at, ok = parseTime(event.Object["eventTime"])
+	}
+	if !ok {
+		at, ok = parseTime(event.Object["firstTimestamp"])
+	}
+	if !ok {
+		return timelineEntry{}, false
+	}
+	eventType := stringValue(event.Object["type"])
+	detail := JoinNonEmpty(" ", eventType, stringValue(event.Object["reason"]), stringValue(event.Object["message"]))
+	if count, ok, _ := unstructured.NestedInt64(event.Object, "count"); ok && count > 1 {
+		detail = fmt.Sprintf("%s (x%d)", detail, count)
+	}
+	return timelineEntry{
+		at:         at,
+		crName:     eventNodeType(event),
+		objectName: stringValue(unstructuredValue(event.Object, "involvedObject", "name")),
+		source:     "event",
+		detail:     detail,
+		failed:     eventType == "Warning",
+	}, true
+}
+
+// eventNodeType returns the type in the tree of the object involved in an event, e.g. ksvc for a Knative Service
+// and kpa for a PodAutoscaler, or its lowercased kind for an object which is not in the tree
+func eventNodeType(event unstructured.Unstructured) string {
+	kind := stringValue(unstructuredValue(event.Object, "involvedObject", "kind"))
+	gv, err := schema.ParseGroupVersion(stringValue(unstructuredValue(event.Object, "involvedObject", "apiVersion")))
+	if err == nil {
+		if nodeType, ok := nodeTypes[schema.GroupKind{Group: gv.Group, Kind: kind}]; ok {
+			return nodeType
+		}
+	}
+	return strings.ToLower(kind)
+}
+
+func unstructuredValue(obj map[string]interface{}, fields ...string) interface{} {
+	v, ok, err := unstructured.NestedFieldNoCopy(obj, fields...)
+	if !ok || err != nil {
+		return nil
+	}
+	return v
+}
+
+func stringValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+func parseTime(v interface{}) (time.Time, bool) {
+	s, ok := v.(string)
+	if !ok || s == "" {
+		return time.Time{}, false
+	}
+	at, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return at, true
+}
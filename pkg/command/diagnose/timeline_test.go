@@ -0,0 +1,168 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"gotest.tools/v3/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	. "knative.dev/kn-plugin-diag/pkg/models"
+)
+
+func mustParseTime(t *testing.T, s string) time.Time {
+	at, ok := parseTime(s)
+	assert.Assert(t, ok, s)
+	return at
+}
+
+func TestEventTimelineEntry(t *testing.T) {
+	tests := []struct {
+		name   string
+		event  map[string]interface{}
+		want   timelineEntry
+		wantOk bool
+	}{
+		{
+			name: "lastTimestamp of a repeated warning on a pod",
+			event: map[string]interface{}{
+				"involvedObject": map[string]interface{}{"kind": "Pod", "apiVersion": "v1", "name": "hello-00001-deployment-abc-xyz"},
+				"type":           "Warning", "reason": "BackOff", "message": "Back-off restarting failed container", "count": int64(5),
+				"firstTimestamp": "2021-06-01T10:00:00Z", "lastTimestamp": "2021-06-01T10:05:00Z",
+			},
+			want: timelineEntry{at: mustParseTime(t, "2021-06-01T10:05:00Z"), crName: "pod", objectName: "hello-00001-deployment-abc-xyz",
+				source: "event", detail: "Warning BackOff Back-off restarting failed container (x5)", failed: true},
+			wantOk: true,
+		},
+		{
+			name: "eventTime without lastTimestamp on a ksvc",
+			event: map[string]interface{}{
+				"involvedObject": map[string]interface{}{"kind": "Service", "apiVersion": "serving.knative.dev/v1", "name": "hello"},
+				"type":           "Normal", "reason": "Created",
+				"eventTime": "2021-06-01T10:01:00Z", "firstTimestamp": "2021-06-01T10:00:00Z",
+			},
+			want: timelineEntry{at: mustParseTime(t, "2021-06-01T10:01:00Z"), crName: "ksvc", objectName: "hello",
+				source: "event", detail: "Normal Created"},
+			wantOk: true,
+		},
+		{
+			name: "firstTimestamp only on a PodAutoscaler",
+			event: map[string]interface{}{
+				"involvedObject": map[string]interface{}{"kind": "PodAutoscaler", "apiVersion": "autoscaling.internal.knative.dev/v1alpha1", "name": "hello-00001"},
+				"type":           "Normal", "reason": "SuccessfulCreate", "count": int64(1),
+				"firstTimestamp": "2021-06-01T10:00:00Z",
+			},
+			want: timelineEntry{at: mustParseTime(t, "2021-06-01T10:00:00Z"), crName: "kpa", objectName: "hello-00001",
+				source: "event", detail: "Normal SuccessfulCreate"},
+			wantOk: true,
+		},
+		{
+			name: "kind outside of the tree",
+			event: map[string]interface{}{
+				"involvedObject": map[string]interface{}{"kind": "Endpoints", "apiVersion": "v1", "name": "hello-00001"},
+				"type":           "Warning", "reason": "FailedToUpdateEndpoint",
+				"lastTimestamp": "2021-06-01T10:00:00Z",
+			},
+			want: timelineEntry{at: mustParseTime(t, "2021-06-01T10:00:00Z"), crName: "endpoints", objectName: "hello-00001",
+				source: "event", detail: "Warning FailedToUpdateEndpoint", failed: true},
+			wantOk: true,
+		},
+		{
+			name: "no timestamp",
+			event: map[string]interface{}{
+				"involvedObject": map[string]interface{}{"kind": "Pod", "name": "hello-00001-deployment-abc-xyz"},
+				"type":           "Normal", "reason": "Pulled",
+			},
+			wantOk: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, ok := eventTimelineEntry(unstructured.Unstructured{Object: tt.event})
+			assert.Equal(t, ok, tt.wantOk)
+			assert.DeepEqual(t, entry, tt.want, cmp.AllowUnexported(timelineEntry{}))
+		})
+	}
+}
+
+func TestPodTimelineEntries(t *testing.T) {
+	pod := &ReportNode{Type: "pod", Name: "hello-00001-deployment-abc-xyz", Object: &unstructured.Unstructured{Object: map[string]interface{}{
+		"status": map[string]interface{}{
+			"startTime": "2021-06-01T10:00:00Z",
+			"containerStatuses": []interface{}{
+				map[string]interface{}{
+					"name": "user-container",
+					"lastState": map[string]interface{}{"terminated": map[string]interface{}{
+						"reason": "Error", "exitCode": int64(1), "startedAt": "2021-06-01T10:00:05Z", "finishedAt": "2021-06-01T10:00:06Z"}},
+					"state": map[string]interface{}{"running": map[string]interface{}{"startedAt": "2021-06-01T10:00:20Z"}},
+				},
+				map[string]interface{}{
+					"name":  "queue-proxy",
+					"state": map[string]interface{}{"terminated": map[string]interface{}{"reason": "Completed", "exitCode": int64(0), "finishedAt": "2021-06-01T10:00:30Z"}},
+				},
+			},
+		},
+	}}}
+	entry := func(at, detail string, failed bool) timelineEntry {
+		return timelineEntry{at: mustParseTime(t, at), crName: "pod", objectName: pod.Name, source: "pod", detail: detail, failed: failed}
+	}
+	want := []timelineEntry{
+		entry("2021-06-01T10:00:00Z", "pod started", false),
+		entry("2021-06-01T10:00:05Z", "container user-container started", false),
+		entry("2021-06-01T10:00:06Z", "container user-container terminated Error exit code 1", true),
+		entry("2021-06-01T10:00:20Z", "container user-container running", false),
+		entry("2021-06-01T10:00:30Z", "container queue-proxy terminated Completed exit code 0", false),
+	}
+	assert.DeepEqual(t, podTimelineEntries(pod), want, cmp.AllowUnexported(timelineEntry{}))
+}
+
+func TestMergeTimeline(t *testing.T) {
+	root := &ReportNode{
+		Type: "ksvc",
+		Name: "hello",
+		Conditions: []ReportCondition{
+			{Type: "Ready", Status: "False", Reason: "RevisionFailed", LastTransitionTime: "2021-06-01T10:00:10Z"},
+			{Type: "RoutesReady", Status: "True", LastTransitionTime: "2021-06-01T10:00:10Z", AsExpected: true},
+			{Type: "ConfigurationsReady", Status: "Unknown"},
+		},
+		Children: []*ReportNode{
+			{Type: "revision", Name: "hello-00001", Conditions: []ReportCondition{
+				{Type: "Ready", Status: "True", LastTransitionTime: "2021-06-01T10:00:05Z", AsExpected: true},
+			}},
+		},
+	}
+	events := []unstructured.Unstructured{
+		{Object: map[string]interface{}{
+			"involvedObject": map[string]interface{}{"kind": "Revision", "apiVersion": "serving.knative.dev/v1", "name": "hello-00001"},
+			"type":           "Warning", "reason": "InternalError", "lastTimestamp": "2021-06-01T10:00:01Z",
+		}},
+	}
+	got := []string{}
+	for _, entry := range mergeTimeline(root, events) {
+		got = append(got, entry.at.Format(time.RFC3339)+" "+entry.crName+" "+entry.source+" "+entry.detail)
+	}
+	assert.DeepEqual(t, got, []string{
+		"2021-06-01T10:00:01Z revision event Warning InternalError",
+		"2021-06-01T10:00:05Z revision condition Ready=True",
+		//the entries at the same time keep the order of the tree
+		"2021-06-01T10:00:10Z ksvc condition Ready=False RevisionFailed",
+		"2021-06-01T10:00:10Z ksvc condition RoutesReady=True",
+	})
+}
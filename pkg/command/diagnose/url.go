@@ -0,0 +1,298 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/fatih/color"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"knative.dev/networking/pkg/apis/networking"
+	networkingconfig "knative.dev/networking/pkg/config"
+	"knative.dev/pkg/network"
+	"knative.dev/serving/pkg/apis/serving"
+	routeconfig "knative.dev/serving/pkg/reconciler/route/config"
+	"knative.dev/serving/pkg/reconciler/route/domains"
+
+	. "knative.dev/kn-plugin-diag/pkg/models"
+	. "knative.dev/kn-plugin-diag/pkg/utils"
+)
+
+var (
+	explainURL bool
+	// clusterDomain overrides the cluster domain of the cluster-local hosts, e.g. cluster.local
+	clusterDomain string
+)
+
+// urlStep is a step of the computation of the URL of a route
+type urlStep struct {
+	step  string
+	value string
+	from  string
+}
+
+// printURLExplanation reproduces the URL of the route of the ksvc and of its tags from config-domain and
+// config-network, and compares them to the status of the route and to the hosts of the kingress
+func printURLExplanation(sc *ServingConfiguration) {
+	routes := findReportNodes(sc.report.Root, "route")
+	if len(routes) == 0 {
+		SayWarningMessage("No route found for ksvc %s, the URL can not be explained\n", sc.ksvcName)
+		return
+	}
+
+	domainData := sc.loadServingConfigMap(routeconfig.DomainConfigName)
+	domainConfig, err := routeconfig.NewDomainFromConfigMap(&corev1.ConfigMap{Data: domainData})
+	if err != nil {
+		sc.warn("Invalid configmap %s/%s, %v\n", servingNamespace, routeconfig.DomainConfigName, err)
+		domainConfig, _ = routeconfig.NewDomainFromConfigMap(&corev1.ConfigMap{})
+	}
+	networkData := sc.loadServingConfigMap(networkingconfig.ConfigMapName)
+	networkConfig, err := networkingconfig.NewConfigFromMap(networkData)
+	if err != nil {
+		sc.warn("Invalid configmap %s/%s, the defaults of Knative Serving are used, %v\n", servingNamespace, networkingconfig.ConfigMapName, err)
+		networkConfig, _ = networkingconfig.NewConfigFromMap(nil)
+	}
+	ctx := routeconfig.ToContext(sc.ctx, &routeconfig.Config{Domain: domainConfig, Network: networkConfig})
+
+	for _, route := range routes {
+		steps, notes := sc.explainRouteURL(ctx, route, domainData, networkData, domainConfig, networkConfig)
+		fmt.Printf("\nURL of route %s\n", route.Name)
+		table := NewTable(os.Stdout, []string{"Step", "Value", "From"})
+		table.SetSeperator(false)
+		for _, step := range steps {
+			table.Add([]string{step.step, step.value, step.from})
+		}
+		table.Print()
+		for _, note := range notes {
+			fmt.Printf("* %s\n", note)
+		}
+	}
+}
+
+// explainRouteURL returns the steps computing the URLs of the route and the notes on their differences with the status
+func (sc *ServingConfiguration) explainRouteURL(ctx context.Context, route *ReportNode, domainData, networkData map[string]string,
+	domainConfig *routeconfig.Domain, networkConfig *networkingconfig.Config) ([]urlStep, []string) {
+	meta := metav1.ObjectMeta{
+		Name:        route.Object.GetName(),
+		Namespace:   route.Object.GetNamespace(),
+		Labels:      route.Object.GetLabels(),
+		Annotations: route.Object.GetAnnotations(),
+	}
+	steps := []urlStep{}
+	notes := []string{}
+	c := color.New(color.FgRed).Add(color.Bold)
+
+	clusterLocal := meta.Labels[networking.VisibilityLabelKey] == serving.VisibilityClusterLocal
+	if value, ok := meta.Labels[networking.VisibilityLabelKey]; ok {
+		steps = append(steps, urlStep{"visibility", value, "label " + networking.VisibilityLabelKey + " of the route"})
+	} else {
+		steps = append(steps, urlStep{"visibility", "external", "no label " + networking.VisibilityLabelKey + " on the route"})
+	}
+
+	//the domains of Knative Serving use the cluster domain of the machine running it, which is not this one
+	localDomain, localSource := routeClusterDomain(route.Object)
+	steps = append(steps, urlStep{"cluster domain", localDomain, localSource})
+
+	domain := domainConfig.LookupDomainForLabels(meta.Labels)
+	if _, ok := domainData[domain]; clusterLocal || (domain == routeconfig.DefaultDomain && !ok) {
+		domain = "svc." + localDomain
+	}
+	steps = append(steps, urlStep{"domain", domain, domainSource(domain, clusterLocal, domainData, domainConfig)})
+	if !clusterLocal && domain == "svc."+localDomain {
+		if _, ok := domainData[domain]; !ok {
+			notes = append(notes, fmt.Sprintf("No domain of %s matches the labels of the route, so it falls back to %s and is only reachable inside the cluster", routeconfig.DomainConfigName, domain))
+		}
+	}
+
+	if clusterLocal {
+		steps = append(steps, urlStep{"domain-template", networkingconfig.DefaultDomainTemplate, "the default template, the domain-template does not apply to cluster-local routes"})
+	} else {
+		steps = append(steps, urlStep{"domain-template", networkConfig.DomainTemplate, networkKeySource(networkData, networkingconfig.DomainTemplateKey, "domainTemplate")})
+	}
+
+	host, err := domainNameFromTemplate(meta, meta.Name, domain, clusterLocal, networkConfig)
+	if err != nil {
+		steps = append(steps, urlStep{"host", c.Sprintf("%v", err), fmt.Sprintf("Name=%s Namespace=%s Domain=%s", meta.Name, meta.Namespace, domain)})
+		return steps, notes
+	}
+	steps = append(steps, urlStep{"host", host, fmt.Sprintf("Name=%s Namespace=%s Domain=%s", meta.Name, meta.Namespace, domain)})
+
+	scheme, schemeSource := urlScheme(clusterLocal, networkData, networkConfig)
+	steps = append(steps, urlStep{"scheme", scheme, schemeSource})
+
+	expected := scheme + "://" + host
+	actual, _, _ := unstructured.NestedString(route.Object.Object, "status", "url")
+	steps = append(steps, urlStep{"url", expected, "computed"})
+	steps = append(steps, compareURLStep("status.url", actual, expected, c))
+	if actual != "" && actual != expected {
+		notes = append(notes, "status.url differs from the computed URL: the route may not be reconciled yet since the ConfigMaps changed, or its labels differ from the ones of the ksvc")
+	}
+
+	//the tags get their own host from the tag-template, in the domain of the route
+	expectedHosts := sets.New(host)
+	traffic, _, _ := unstructured.NestedSlice(route.Object.Object, "status", "traffic")
+	for _, target := range traffic {
+		t, ok := target.(map[string]interface{})
+		if !ok || stringValue(t["tag"]) == "" {
+			continue
+		}
+		tag := stringValue(t["tag"])
+		tagName, err := domains.HostnameFromTemplate(ctx, meta.Name, tag)
+		if err == nil {
+			var tagHost string
+			if tagHost, err = domainNameFromTemplate(meta, tagName, domain, clusterLocal, networkConfig); err == nil {
+				expectedHosts.Insert(tagHost)
+				steps = append(steps, urlStep{"tag " + tag, tagName, "tag-template " + networkConfig.TagTemplate + ", " + networkKeySource(networkData, networkingconfig.TagTemplateKey, "tagTemplate")})
+				steps = append(steps, compareURLStep("tag "+tag+" status url", stringValue(t["url"]), scheme+"://"+tagHost, c))
+				continue
+			}
+		}
+		steps = append(steps, urlStep{"tag " + tag, c.Sprintf("%v", err), "tag-template " + networkConfig.TagTemplate})
+	}
+
+	//the kingress also serves the cluster-local hosts, e.g. hello.demo.svc and hello.demo.svc.cluster.local
+	for _, kingress := range findReportNodes(route, "kingress") {
+		rules, _, _ := unstructured.NestedSlice(kingress.Object.Object, "spec", "rules")
+		for i, rule := range rules {
+			r, ok := rule.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			hosts, _, _ := unstructured.NestedStringSlice(r, "hosts")
+			from := fmt.Sprintf("kingress %s rule %d, %s", kingress.Name, i, stringValue(r["visibility"]))
+			if stringValue(r["visibility"]) == "ClusterLocal" || hasExpectedHost(hosts, expectedHosts) {
+				steps = append(steps, urlStep{"kingress hosts", strings.Join(hosts, ","), from})
+				continue
+			}
+			steps = append(steps, urlStep{"kingress hosts", c.Sprintf("%s", strings.Join(hosts, ",")), from + ", none of the computed hosts"})
+			notes = append(notes, fmt.Sprintf("The external hosts of kingress %s do not include the computed ones %s, the ingress does not serve the URL", kingress.Name, strings.Join(sets.List(expectedHosts), ",")))
+		}
+	}
+	return steps, notes
+}
+
+// routeClusterDomain returns the cluster domain and where it comes from: --cluster-domain, else the cluster-local
+// address of the route, e.g. cluster.local of http://hello.demo.svc.cluster.local, else the local resolv.conf
+func routeClusterDomain(route *unstructured.Unstructured) (string, string) {
+	if clusterDomain != "" {
+		return clusterDomain, "--cluster-domain"
+	}
+	address, _, _ := unstructured.NestedString(route.Object, "status", "address", "url")
+	if u, err := url.Parse(address); err == nil {
+		if i := strings.Index(u.Hostname(), ".svc."); i >= 0 {
+			return u.Hostname()[i+len(".svc."):], "status.address.url of the route"
+		}
+	}
+	return network.GetClusterDomainName(), "the local resolv.conf or CLUSTER_DOMAIN, no status.address.url on the route, set --cluster-domain if it differs"
+}
+
+// domainNameFromTemplate executes the domain-template like the route reconciler, with the domain computed
+// from the cluster domain of the route instead of the local one
+func domainNameFromTemplate(meta metav1.ObjectMeta, name, domain string, clusterLocal bool, networkConfig *networkingconfig.Config) (string, error) {
+	data := networkingconfig.DomainTemplateValues{
+		Name:        name,
+		Namespace:   meta.Namespace,
+		Domain:      domain,
+		Annotations: meta.Annotations,
+		Labels:      meta.Labels,
+	}
+	templ := networkConfig.GetDomainTemplate()
+	if clusterLocal {
+		templ = template.Must(template.New("domain-template").Parse(networkingconfig.DefaultDomainTemplate))
+	}
+	buf := bytes.Buffer{}
+	if err := templ.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("error executing the DomainTemplate: %w", err)
+	}
+	if errs := validation.IsFullyQualifiedDomainName(field.NewPath("url"), buf.String()); errs != nil {
+		return "", fmt.Errorf("invalid domain name %q: %w", buf.String(), errs.ToAggregate())
+	}
+	return buf.String(), nil
+}
+
+// domainSource explains which entry of config-domain gave the domain
+func domainSource(domain string, clusterLocal bool, domainData map[string]string, domainConfig *routeconfig.Domain) string {
+	if clusterLocal {
+		return "the cluster domain, for the cluster-local routes"
+	}
+	if _, ok := domainData[domain]; !ok {
+		return fmt.Sprintf("the default, no domain of %s matches", routeconfig.DomainConfigName)
+	}
+	selector := domainConfig.Domains[domain].Selector
+	if selector == nil || len(selector.Selector) == 0 {
+		return fmt.Sprintf("%s %s, without selector", routeconfig.DomainConfigName, domain)
+	}
+	pairs := []string{}
+	for k, v := range selector.Selector {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return fmt.Sprintf("%s %s, selector %s matches the labels of the route", routeconfig.DomainConfigName, domain, strings.Join(pairs, ","))
+}
+
+// networkKeySource tells whether a setting of config-network is set, by its key or by its legacy key
+func networkKeySource(networkData map[string]string, key, legacyKey string) string {
+	if _, ok := networkData[key]; ok {
+		return networkingconfig.ConfigMapName + " " + key
+	}
+	if _, ok := networkData[legacyKey]; ok {
+		return networkingconfig.ConfigMapName + " " + legacyKey + " (deprecated)"
+	}
+	return "the default"
+}
+
+// urlScheme returns the scheme of the URL, https once external-domain-tls provisions a certificate for the route
+func urlScheme(clusterLocal bool, networkData map[string]string, networkConfig *networkingconfig.Config) (string, string) {
+	switch {
+	case clusterLocal:
+		return "http", "cluster-local routes are served over http"
+	case networkConfig.ExternalDomainTLS:
+		return "https", networkingconfig.ConfigMapName + " " + networkingconfig.ExternalDomainTLSKey + " is enabled"
+	}
+	return networkConfig.DefaultExternalScheme, networkKeySource(networkData, networkingconfig.DefaultExternalSchemeKey, "defaultExternalScheme")
+}
+
+func compareURLStep(step, actual, expected string, c *color.Color) urlStep {
+	switch {
+	case actual == "":
+		return urlStep{step, "<none>", "not set yet"}
+	case actual == expected:
+		return urlStep{step, actual, "matches"}
+	}
+	return urlStep{step, c.Sprintf("%s", actual), "differs from " + expected}
+}
+
+func hasExpectedHost(hosts []string, expected sets.Set[string]) bool {
+	for _, host := range hosts {
+		if expected.Has(host) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	networkingconfig "knative.dev/networking/pkg/config"
+	"knative.dev/pkg/network"
+	routeconfig "knative.dev/serving/pkg/reconciler/route/config"
+
+	. "knative.dev/kn-plugin-diag/pkg/models"
+)
+
+func TestRouteClusterDomain(t *testing.T) {
+	tests := []struct {
+		name    string
+		flag    string
+		address string
+		domain  string
+		source  string
+	}{
+		{"flag wins", "k8s.example", "http://hello.demo.svc.corp.internal", "k8s.example", "--cluster-domain"},
+		{"route address", "", "http://hello.demo.svc.corp.internal", "corp.internal", "status.address.url of the route"},
+		{"route address with port", "", "http://hello.demo.svc.cluster.local:8080", "cluster.local", "status.address.url of the route"},
+		{"no route address", "", "", network.GetClusterDomainName(),
+			"the local resolv.conf or CLUSTER_DOMAIN, no status.address.url on the route, set --cluster-domain if it differs"},
+	}
+	defer func() { clusterDomain = "" }()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clusterDomain = tt.flag
+			route := &unstructured.Unstructured{Object: map[string]interface{}{}}
+			if tt.address != "" {
+				route.Object["status"] = map[string]interface{}{"address": map[string]interface{}{"url": tt.address}}
+			}
+			domain, source := routeClusterDomain(route)
+			assert.Equal(t, domain, tt.domain)
+			assert.Equal(t, source, tt.source)
+		})
+	}
+}
+
+func TestExplainRouteURLTags(t *testing.T) {
+	route := func(visibility, address string) *ReportNode {
+		object := &unstructured.Unstructured{Object: map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "hello", "namespace": "demo"},
+			"status": map[string]interface{}{
+				"address": map[string]interface{}{"url": address},
+				"traffic": []interface{}{
+					map[string]interface{}{"revisionName": "hello-00001", "percent": int64(100)},
+					map[string]interface{}{"revisionName": "hello-00001", "tag": "v1", "url": "http://v1-hello.demo.svc.corp.internal"},
+				},
+			},
+		}}
+		if visibility != "" {
+			object.SetLabels(map[string]string{"networking.knative.dev/visibility": visibility})
+		}
+		return &ReportNode{Type: "route", Name: "hello", Object: object}
+	}
+	tests := []struct {
+		name       string
+		route      *ReportNode
+		domainData map[string]string
+		wantHost   string
+		wantTag    urlStep
+	}{
+		{
+			name:     "cluster-local route in the cluster domain of the route",
+			route:    route("cluster-local", "http://hello.demo.svc.corp.internal"),
+			wantHost: "hello.demo.svc.corp.internal",
+			wantTag:  urlStep{"tag v1 status url", "http://v1-hello.demo.svc.corp.internal", "matches"},
+		},
+		{
+			name:       "external route in the domain of config-domain",
+			route:      route("", "http://hello.demo.svc.corp.internal"),
+			domainData: map[string]string{"example.com": ""},
+			wantHost:   "hello.demo.example.com",
+			wantTag:    urlStep{"tag v1 status url", "http://v1-hello.demo.svc.corp.internal", "differs from http://v1-hello.demo.example.com"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			domainConfig, err := routeconfig.NewDomainFromConfigMap(&corev1.ConfigMap{Data: tt.domainData})
+			assert.NilError(t, err)
+			networkConfig, err := networkingconfig.NewConfigFromMap(nil)
+			assert.NilError(t, err)
+			ctx := routeconfig.ToContext(context.Background(), &routeconfig.Config{Domain: domainConfig, Network: networkConfig})
+			sc := &ServingConfiguration{ksvcName: "hello", Namespace: "demo", ctx: ctx}
+
+			steps, _ := sc.explainRouteURL(ctx, tt.route, tt.domainData, nil, domainConfig, networkConfig)
+			shown := make(map[string]urlStep)
+			for _, step := range steps {
+				shown[step.step] = step
+			}
+			assert.Equal(t, shown["host"].value, tt.wantHost)
+			assert.Equal(t, shown["tag v1"].value, "v1-hello")
+			assert.DeepEqual(t, shown[tt.wantTag.step], tt.wantTag, cmp.AllowUnexported(urlStep{}))
+		})
+	}
+}
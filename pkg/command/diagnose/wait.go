@@ -0,0 +1,191 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	. "knative.dev/kn-plugin-diag/pkg/utils"
+)
+
+const (
+	waitPollInterval = 2 * time.Second
+	// waitReportTimeout bounds the last load reporting on the state of the service once the wait is over
+	waitReportTimeout = 10 * time.Second
+)
+
+var (
+	waitNamespace string
+	waitTimeout   time.Duration
+)
+
+// NewWaitCmd represents the wait command
+func NewWaitCmd(p *ConnectionConfig) *cobra.Command {
+	var waitCmd = &cobra.Command{
+		Use:   "wait",
+		Short: "kn-diag wait",
+		Long: `Wait until the latest created revision of a knative service is ready and routed. For example
+kn-diag wait <ksvc-name> --timeout 5m`,
+
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return fmt.Errorf(`'wait' requires a input arguments for knative servie name.
+For example: kn-diag wait <ksvc-name> -n <namespace> --timeout 5m`)
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ksvcName := args[0]
+			Namespace := resolveNamespace(cmd, waitNamespace, p)
+			dynClient, err := newDynamicClient(p)
+			if err != nil {
+				return err
+			}
+			sc := newServingConfiguration(ksvcName, Namespace, dynClient, nil)
+
+			ctx, cancel := signal.NotifyContext(cmd.Context(), os.Interrupt)
+			defer cancel()
+			ctx, cancelTimeout := context.WithTimeout(ctx, waitTimeout)
+			defer cancelTimeout()
+			return waitForService(ctx, sc)
+		},
+	}
+
+	waitCmd.Flags().StringVarP(&waitNamespace, "namespace", "n", "", "the target namespace")
+	waitCmd.Flags().DurationVarP(&waitTimeout, "timeout", "", 5*time.Minute, "the maximum time to wait for the service")
+	waitCmd.Flags().IntVarP(&maxPods, "max-pods", "", 10, "the maximum number of unhealthy pods shown in detail under a replicaset, the others are only counted")
+	return waitCmd
+}
+
+// waitForService polls the object hierarchy until the ksvc is ready, printing the pending
+// node every time it changes. When ctx is done first the full tree is printed with the findings.
+// The requests are sent with ctx, so that the timeout and Ctrl+C cancel a slow API call as well.
+func waitForService(ctx context.Context, sc *ServingConfiguration) error {
+	start := time.Now()
+	lastProgress := ""
+	sc.ctx = ctx
+
+	for {
+		sc.quiet = true
+		err := sc.load()
+		sc.quiet = false
+		if err != nil {
+			return err
+		}
+
+		ready, pending := serviceReady(sc)
+		if ready {
+			fmt.Printf("[%s] ksvc %s is ready, revision %s is serving traffic\n",
+				elapsed(start), sc.ksvcName, sc.report.LatestCreatedRevision)
+			return nil
+		}
+		if cause := sc.printable().report.RootCause; cause != nil {
+			pending = pending + ", " + cause.String()
+		}
+		if pending != lastProgress {
+			fmt.Printf("[%s] waiting: %s\n", elapsed(start), pending)
+			lastProgress = pending
+		}
+
+		select {
+		case <-ctx.Done():
+			return waitFailed(sc, start)
+		case <-time.After(waitPollInterval):
+		}
+	}
+}
+
+func waitFailed(sc *ServingConfiguration, start time.Time) error {
+	//load the objects once more to report on the latest state, the context of the wait is done already
+	ctx, cancel := context.WithTimeout(context.Background(), waitReportTimeout)
+	defer cancel()
+	sc.ctx = ctx
+	if err := sc.load(); err != nil {
+		return err
+	}
+	view := sc.printable()
+	if view.report.Root != nil {
+		if err := dumpToTables(view, ""); err != nil {
+			return err
+		}
+	}
+	if len(view.report.Findings) != 0 {
+		SayFailedMessage("Findings:\n")
+		for _, f := range view.report.Findings {
+			fmt.Printf("  %s\n", f.String())
+		}
+	}
+	return fmt.Errorf("ksvc %s is not ready after %s", sc.ksvcName, elapsed(start))
+}
+
+// serviceReady checks that the latest created revision of the ksvc is ready and receives a share of
+// the traffic, otherwise it describes what is pending. A tag-only entry has no percent and does not count.
+func serviceReady(sc *ServingConfiguration) (bool, string) {
+	if sc.report.Root == nil || sc.report.Root.Object == nil {
+		return false, fmt.Sprintf("ksvc %s not found in namespace %s", sc.ksvcName, sc.Namespace)
+	}
+	ksvc := sc.report.Root.Object.Object
+
+	generation, _, _ := unstructured.NestedInt64(ksvc, "metadata", "generation")
+	observedGeneration, _, _ := unstructured.NestedInt64(ksvc, "status", "observedGeneration")
+	if observedGeneration < generation {
+		return false, fmt.Sprintf("ksvc %s generation %d is not observed yet", sc.ksvcName, generation)
+	}
+
+	latestCreated, _, _ := unstructured.NestedString(ksvc, "status", "latestCreatedRevisionName")
+	latestReady, _, _ := unstructured.NestedString(ksvc, "status", "latestReadyRevisionName")
+	if latestCreated == "" || latestCreated != latestReady {
+		return false, fmt.Sprintf("revision %s is not ready", latestCreated)
+	}
+
+	routed := false
+	traffic, _, _ := unstructured.NestedSlice(ksvc, "status", "traffic")
+	for _, target := range traffic {
+		m, ok := target.(map[string]interface{})
+		if !ok || m["revisionName"] != latestReady {
+			continue
+		}
+		if percent, _, _ := unstructured.NestedInt64(m, "percent"); percent > 0 {
+			routed = true
+		}
+	}
+	if !routed {
+		return false, fmt.Sprintf("revision %s is not routed yet", latestReady)
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(ksvc, "status", "conditions")
+	for _, condition := range conditions {
+		if m, ok := condition.(map[string]interface{}); ok && m["type"] == "Ready" {
+			if m["status"] == "True" {
+				return true, ""
+			}
+			return false, strings.TrimSpace(fmt.Sprintf("ksvc %s Ready=%v %s", sc.ksvcName, m["status"], stringValue(m["reason"])))
+		}
+	}
+	return false, fmt.Sprintf("ksvc %s has no Ready condition yet", sc.ksvcName)
+}
+
+func elapsed(start time.Time) string {
+	return time.Since(start).Round(time.Second).String()
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/fake"
+
+	. "knative.dev/kn-plugin-diag/pkg/models"
+	. "knative.dev/kn-plugin-diag/pkg/utils"
+)
+
+func TestServiceReady(t *testing.T) {
+	readyCondition := []interface{}{map[string]interface{}{"type": "Ready", "status": "True"}}
+	tests := []struct {
+		name    string
+		status  map[string]interface{}
+		ready   bool
+		pending string
+	}{
+		{
+			name: "latest revision routed",
+			status: map[string]interface{}{
+				"observedGeneration":        int64(2),
+				"latestCreatedRevisionName": "hello-00002",
+				"latestReadyRevisionName":   "hello-00002",
+				"traffic":                   []interface{}{map[string]interface{}{"revisionName": "hello-00002", "percent": int64(100)}},
+				"conditions":                readyCondition,
+			},
+			ready: true,
+		},
+		{
+			name: "generation not observed",
+			status: map[string]interface{}{
+				"observedGeneration": int64(1),
+			},
+			pending: "ksvc hello generation 2 is not observed yet",
+		},
+		{
+			name: "latest revision not ready",
+			status: map[string]interface{}{
+				"observedGeneration":        int64(2),
+				"latestCreatedRevisionName": "hello-00002",
+				"latestReadyRevisionName":   "hello-00001",
+			},
+			pending: "revision hello-00002 is not ready",
+		},
+		{
+			name: "latest revision only tagged",
+			status: map[string]interface{}{
+				"observedGeneration":        int64(2),
+				"latestCreatedRevisionName": "hello-00002",
+				"latestReadyRevisionName":   "hello-00002",
+				"traffic": []interface{}{
+					map[string]interface{}{"revisionName": "hello-00001", "percent": int64(100)},
+					map[string]interface{}{"revisionName": "hello-00002", "tag": "candidate"},
+				},
+				"conditions": readyCondition,
+			},
+			pending: "revision hello-00002 is not routed yet",
+		},
+		{
+			name: "latest revision at 0 percent",
+			status: map[string]interface{}{
+				"observedGeneration":        int64(2),
+				"latestCreatedRevisionName": "hello-00002",
+				"latestReadyRevisionName":   "hello-00002",
+				"traffic": []interface{}{
+					map[string]interface{}{"revisionName": "hello-00001", "percent": int64(100)},
+					map[string]interface{}{"revisionName": "hello-00002", "percent": int64(0)},
+				},
+				"conditions": readyCondition,
+			},
+			pending: "revision hello-00002 is not routed yet",
+		},
+		{
+			name: "ksvc not ready",
+			status: map[string]interface{}{
+				"observedGeneration":        int64(2),
+				"latestCreatedRevisionName": "hello-00002",
+				"latestReadyRevisionName":   "hello-00002",
+				"traffic":                   []interface{}{map[string]interface{}{"revisionName": "hello-00002", "percent": int64(100)}},
+				"conditions":                []interface{}{map[string]interface{}{"type": "Ready", "status": "False", "reason": "IngressNotConfigured"}},
+			},
+			pending: "ksvc hello Ready=False IngressNotConfigured",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ksvc := &unstructured.Unstructured{Object: map[string]interface{}{
+				"metadata": map[string]interface{}{"name": "hello", "generation": int64(2)},
+				"status":   tt.status,
+			}}
+			sc := &ServingConfiguration{ksvcName: "hello", Namespace: "demo", report: &Report{Root: &ReportNode{Type: "ksvc", Name: "hello", Object: ksvc}}}
+			ready, pending := serviceReady(sc)
+			assert.Equal(t, ready, tt.ready)
+			assert.Equal(t, pending, tt.pending)
+		})
+	}
+}
+
+// captureStdout returns what f prints on the standard output
+func captureStdout(t *testing.T, f func()) string {
+	r, w, err := os.Pipe()
+	assert.NilError(t, err)
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	output := make(chan string)
+	go func() {
+		content, _ := io.ReadAll(r)
+		output <- string(content)
+	}()
+	f()
+	w.Close()
+	return <-output
+}
+
+func TestWaitForServiceTimeout(t *testing.T) {
+	failure := "failed to connect to postgres://admin:s3cret@db:5432/app"
+	ksvc := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "serving.knative.dev/v1",
+		"kind":       "Service",
+		"metadata":   map[string]interface{}{"name": "hello", "namespace": "demo", "generation": int64(1), "creationTimestamp": "2021-06-01T10:00:00Z"},
+		"status": map[string]interface{}{
+			"observedGeneration": int64(1),
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Ready", "status": "False", "reason": "RevisionFailed", "message": failure},
+			},
+		},
+	}}
+	r, err := NewRedactor(nil)
+	assert.NilError(t, err)
+	sc := newServingConfiguration("hello", "demo", fake.NewSimpleDynamicClient(runtime.NewScheme(), ksvc), nil)
+	sc.redactor = r
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	var waitErr error
+	output := captureStdout(t, func() {
+		waitErr = waitForService(ctx, sc)
+	})
+	assert.ErrorContains(t, waitErr, "ksvc hello is not ready after")
+	//the root cause and the findings are printed redacted
+	assert.Assert(t, strings.Contains(output, "waiting: revision  is not ready, ksvc hello: Ready=False RevisionFailed: "+r.RedactText(failure)), output)
+	assert.Assert(t, strings.Contains(output, "  ksvc hello: Ready=False RevisionFailed: "+r.RedactText(failure)+"\n"), output)
+	assert.Assert(t, !strings.Contains(output, "s3cret"), output)
+}
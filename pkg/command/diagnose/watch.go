@@ -0,0 +1,183 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+
+	. "knative.dev/kn-plugin-diag/pkg/models"
+	. "knative.dev/kn-plugin-diag/pkg/utils"
+)
+
+const (
+	//wait a bit after a change before redrawing, a rollout touches many resources at once
+	watchDebounce = 500 * time.Millisecond
+	clearScreen   = "\033[H\033[2J"
+)
+
+// changeSet collects the GVRs changed since the last frame
+type changeSet struct {
+	mu      sync.Mutex
+	changed map[schema.GroupVersionResource]bool
+	notify  chan struct{}
+}
+
+func newChangeSet() *changeSet {
+	return &changeSet{
+		changed: make(map[schema.GroupVersionResource]bool),
+		notify:  make(chan struct{}, 1),
+	}
+}
+
+func (cs *changeSet) add(gvr schema.GroupVersionResource) {
+	cs.mu.Lock()
+	cs.changed[gvr] = true
+	cs.mu.Unlock()
+	select {
+	case cs.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (cs *changeSet) drain() map[schema.GroupVersionResource]bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	changed := cs.changed
+	cs.changed = make(map[schema.GroupVersionResource]bool)
+	return changed
+}
+
+// watchServing watches every GVR of the CRD hierarchy in the namespace of sc and redraws
+// the tables in place on each change until ctx is done. Nodes whose conditions changed
+// since the previous frame are highlighted.
+func watchServing(ctx context.Context, sc *ServingConfiguration, verbose string) error {
+
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(sc.dynClient, 0, sc.Namespace, nil)
+	changes := newChangeSet()
+
+	for _, gvr := range sc.loader.GVRs() {
+		//skip the resources which are not installed or not allowed, the informer would retry forever
+		_, err := sc.dynClient.Resource(gvr).Namespace(sc.Namespace).List(ctx, metav1.ListOptions{Limit: 1})
+		if err != nil {
+			SayWarningMessage("Failed to watch resource %s, %v\n", gvr.String(), err)
+			continue
+		}
+		gvr := gvr
+		factory.ForResource(gvr).Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				changes.add(gvr)
+			},
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				if resourceChanged(oldObj, newObj) {
+					changes.add(gvr)
+				}
+			},
+			DeleteFunc: func(obj interface{}) {
+				changes.add(gvr)
+			},
+		})
+	}
+
+	factory.Start(ctx.Done())
+	factory.WaitForCacheSync(ctx.Done())
+	//the initial list is already reflected in the first frame
+	changes.drain()
+
+	previous := conditionSignatures(sc.report.Root)
+	if err := drawWatchFrame(sc, verbose); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changes.notify:
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(watchDebounce):
+		}
+
+		fmt.Print(clearScreen)
+		if err := sc.refresh(changes.drain()); err != nil {
+			return err
+		}
+		current := conditionSignatures(sc.report.Root)
+		sc.highlights = make(map[string]bool)
+		for key, signature := range current {
+			if previous[key] != signature {
+				sc.highlights[key] = true
+			}
+		}
+		previous = current
+		if err := drawWatchFrame(sc, verbose); err != nil {
+			return err
+		}
+	}
+}
+
+func drawWatchFrame(sc *ServingConfiguration, verbose string) error {
+	fmt.Printf("Watching ksvc %s in namespace %s, last update at %s. Press Ctrl+C to exit.\n",
+		sc.ksvcName, sc.Namespace, time.Now().Format(time.RFC3339))
+	return dumpToTables(sc.printable(), verbose)
+}
+
+// resourceChanged tells whether an update is a real change, the periodic resyncs of the informers
+// send updates with the same resourceVersion
+func resourceChanged(oldObj, newObj interface{}) bool {
+	oldU, okOld := oldObj.(*unstructured.Unstructured)
+	newU, okNew := newObj.(*unstructured.Unstructured)
+	return !okOld || !okNew || oldU.GetResourceVersion() != newU.GetResourceVersion()
+}
+
+func objectNodeKey(node *ReportNode) string {
+	return node.Type + "/" + node.Name
+}
+
+// conditionSignatures maps each object of the tree to a digest of its status.conditions
+func conditionSignatures(node *ReportNode) map[string]string {
+	signatures := make(map[string]string)
+	var walk func(*ReportNode)
+	walk = func(node *ReportNode) {
+		if node == nil {
+			return
+		}
+		parts := []string{}
+		for _, condition := range node.Conditions {
+			parts = append(parts, fmt.Sprintf("%s=%s(%s)", condition.Type, condition.Status, condition.Reason))
+		}
+		signatures[objectNodeKey(node)] = strings.Join(parts, ";")
+		for _, child := range node.Children {
+			walk(child)
+		}
+	}
+	walk(node)
+	return signatures
+}
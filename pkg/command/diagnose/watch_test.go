@@ -0,0 +1,84 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	. "knative.dev/kn-plugin-diag/pkg/models"
+)
+
+func TestChangeSet(t *testing.T) {
+	revisions := schema.GroupVersionResource{Group: "serving.knative.dev", Version: "v1", Resource: "revisions"}
+	pods := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	changes := newChangeSet()
+
+	changes.add(revisions)
+	changes.add(pods)
+	changes.add(revisions)
+	//the notifications are coalesced while no frame is drawn
+	assert.Equal(t, len(changes.notify), 1)
+	<-changes.notify
+	assert.DeepEqual(t, changes.drain(), map[schema.GroupVersionResource]bool{revisions: true, pods: true})
+	assert.DeepEqual(t, changes.drain(), map[schema.GroupVersionResource]bool{})
+}
+
+func TestResourceChanged(t *testing.T) {
+	withVersion := func(version string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+		obj.SetResourceVersion(version)
+		return obj
+	}
+	tests := []struct {
+		name    string
+		oldObj  interface{}
+		newObj  interface{}
+		changed bool
+	}{
+		{name: "resync with the same version", oldObj: withVersion("10"), newObj: withVersion("10"), changed: false},
+		{name: "new version", oldObj: withVersion("10"), newObj: withVersion("11"), changed: true},
+		{name: "not an unstructured object", oldObj: "10", newObj: withVersion("10"), changed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, resourceChanged(tt.oldObj, tt.newObj), tt.changed)
+		})
+	}
+}
+
+func TestConditionSignatures(t *testing.T) {
+	root := &ReportNode{
+		Type: "ksvc",
+		Name: "hello",
+		Conditions: []ReportCondition{
+			{Type: "Ready", Status: "False", Reason: "RevisionFailed"},
+			{Type: "RoutesReady", Status: "True"},
+		},
+		Children: []*ReportNode{
+			{Type: "configuration", Name: "hello"},
+		},
+	}
+	assert.DeepEqual(t, conditionSignatures(root), map[string]string{
+		"ksvc/hello":          "Ready=False(RevisionFailed);RoutesReady=True()",
+		"configuration/hello": "",
+	})
+	assert.DeepEqual(t, conditionSignatures(nil), map[string]string{})
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnosis
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	// cachePageSize is the number of objects requested per page when a GVR is listed into the cache
+	cachePageSize = 500
+	// indexedLabelPrefix selects the labels the cached objects are indexed by
+	indexedLabelPrefix = "serving.knative.dev/"
+)
+
+// Cache lists every GVR once per namespace and serves the Gets and Lists of the object hierarchy
+// from memory, so that diagnosing many services of a namespace needs a fixed number of API calls
+type Cache struct {
+	dynClient dynamic.Interface
+	mu        sync.Mutex
+	entries   map[cacheKey]*cacheEntry
+}
+
+type cacheKey struct {
+	gvr       schema.GroupVersionResource
+	namespace string
+}
+
+// cacheEntry holds the objects of a GVR in a namespace, indexed by name and by `serving.knative.dev/*` label
+type cacheEntry struct {
+	once    sync.Once
+	err     error
+	items   []*unstructured.Unstructured
+	byName  map[string]*unstructured.Unstructured
+	byLabel map[string][]*unstructured.Unstructured
+}
+
+func NewCache(dynClient dynamic.Interface) *Cache {
+	return &Cache{
+		dynClient: dynClient,
+		entries:   make(map[cacheKey]*cacheEntry),
+	}
+}
+
+// entry returns the objects of gvr in namespace, listing them on the first call only
+func (c *Cache) entry(ctx context.Context, gvr schema.GroupVersionResource, namespace string) *cacheEntry {
+	c.mu.Lock()
+	key := cacheKey{gvr: gvr, namespace: namespace}
+	e, ok := c.entries[key]
+	if !ok {
+		e = &cacheEntry{}
+		c.entries[key] = e
+	}
+	c.mu.Unlock()
+
+	e.once.Do(func() {
+		e.err = e.load(ctx, c.dynClient.Resource(gvr).Namespace(namespace))
+	})
+	return e
+}
+
+func (e *cacheEntry) load(ctx context.Context, client dynamic.ResourceInterface) error {
+	e.byName = make(map[string]*unstructured.Unstructured)
+	e.byLabel = make(map[string][]*unstructured.Unstructured)
+	listOptions := metav1.ListOptions{Limit: cachePageSize}
+	for {
+		objList, err := client.List(ctx, listOptions)
+		if err != nil {
+			return err
+		}
+		for i := range objList.Items {
+			obj := &objList.Items[i]
+			e.items = append(e.items, obj)
+			e.byName[obj.GetName()] = obj
+			for key, value := range obj.GetLabels() {
+				if strings.HasPrefix(key, indexedLabelPrefix) {
+					e.byLabel[key+"="+value] = append(e.byLabel[key+"="+value], obj)
+				}
+			}
+		}
+		if objList.GetContinue() == "" {
+			return nil
+		}
+		listOptions.Continue = objList.GetContinue()
+	}
+}
+
+// get returns a copy of the named object, or a NotFound error like the API server does
+func (c *Cache) get(ctx context.Context, gvr schema.GroupVersionResource, namespace, name string) (*unstructured.Unstructured, error) {
+	e := c.entry(ctx, gvr, namespace)
+	if e.err != nil {
+		return nil, e.err
+	}
+	obj, ok := e.byName[name]
+	if !ok {
+		return nil, apierrors.NewNotFound(gvr.GroupResource(), name)
+	}
+	return obj.DeepCopy(), nil
+}
+
+// list returns copies of the objects matching the label selector of listOptions.
+// The candidates are narrowed with the label index, then the whole selector is matched.
+func (c *Cache) list(ctx context.Context, gvr schema.GroupVersionResource, namespace string, listOptions metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	e := c.entry(ctx, gvr, namespace)
+	if e.err != nil {
+		return nil, e.err
+	}
+	selector, err := labels.Parse(listOptions.LabelSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := e.items
+	requirements, _ := selector.Requirements()
+	for _, requirement := range requirements {
+		if !strings.HasPrefix(requirement.Key(), indexedLabelPrefix) {
+			continue
+		}
+		if requirement.Operator() != selection.Equals && requirement.Operator() != selection.DoubleEquals {
+			continue
+		}
+		indexed := e.byLabel[requirement.Key()+"="+requirement.Values().List()[0]]
+		if len(indexed) < len(candidates) {
+			candidates = indexed
+		}
+	}
+
+	objList := &unstructured.UnstructuredList{}
+	for _, obj := range candidates {
+		if selector.Matches(labels.Set(obj.GetLabels())) {
+			objList.Items = append(objList.Items, *obj.DeepCopy())
+		}
+	}
+	return objList, nil
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnosis
+
+import (
+	"context"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func testCachePod(name string, labels map[string]string) *unstructured.Unstructured {
+	pod := &unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "v1", "kind": "Pod"}}
+	pod.SetName(name)
+	pod.SetNamespace("demo")
+	pod.SetLabels(labels)
+	return pod
+}
+
+var podsGVR = schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+
+func TestCacheList(t *testing.T) {
+	dynClient := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{podsGVR: "PodList"},
+		testCachePod("hello-00001-a", map[string]string{"serving.knative.dev/revision": "hello-00001", "app": "hello"}),
+		testCachePod("hello-00001-b", map[string]string{"serving.knative.dev/revision": "hello-00001", "app": "other"}),
+		testCachePod("hello-00002-a", map[string]string{"serving.knative.dev/revision": "hello-00002", "app": "hello"}),
+		testCachePod("bye-00001-a", map[string]string{"serving.knative.dev/revision": "bye-00001"}),
+	)
+	lists := 0
+	dynClient.PrependReactor("list", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+		lists++
+		return false, nil, nil
+	})
+	cache := NewCache(dynClient)
+
+	tests := []struct {
+		name     string
+		selector string
+		want     []string
+	}{
+		{"indexed label", "serving.knative.dev/revision=hello-00001", []string{"hello-00001-a", "hello-00001-b"}},
+		{"indexed and other labels", "serving.knative.dev/revision=hello-00001,app=hello", []string{"hello-00001-a"}},
+		{"label not indexed", "app=hello", []string{"hello-00001-a", "hello-00002-a"}},
+		{"set based", "serving.knative.dev/revision in (hello-00002,bye-00001)", []string{"bye-00001-a", "hello-00002-a"}},
+		{"no match", "serving.knative.dev/revision=hello-00003", []string{}},
+		{"everything", "", []string{"bye-00001-a", "hello-00001-a", "hello-00001-b", "hello-00002-a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objList, err := cache.list(context.Background(), podsGVR, "demo", metav1.ListOptions{LabelSelector: tt.selector})
+			assert.NilError(t, err)
+			names := []string{}
+			for _, obj := range objList.Items {
+				names = append(names, obj.GetName())
+			}
+			assert.DeepEqual(t, names, tt.want)
+		})
+	}
+	//the pods of the namespace are listed once for all the selectors
+	assert.Equal(t, lists, 1)
+
+	_, err := cache.list(context.Background(), podsGVR, "demo", metav1.ListOptions{LabelSelector: "app in ("})
+	assert.ErrorContains(t, err, "")
+	_, err = cache.get(context.Background(), podsGVR, "demo", "hello-00003-a")
+	assert.Assert(t, apierrors.IsNotFound(err))
+}
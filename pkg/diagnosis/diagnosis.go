@@ -0,0 +1,86 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package diagnosis diagnoses a knative service from Go code, e.g. an operator or a chat bot.
+// The result is a structured Report, rendering it is left to the caller.
+//
+//	report, err := diagnosis.Diagnose(ctx, dynClient, diagnosis.Target{Service: "hello", Namespace: "demo"}, diagnosis.Options{})
+//	if err == nil && report.RootCause != nil {
+//		fmt.Println(report.RootCause.Reason)
+//	}
+package diagnosis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/client-go/dynamic"
+
+	"knative.dev/kn-plugin-diag/pkg/models"
+	"knative.dev/kn-plugin-diag/pkg/utils"
+)
+
+type (
+	// Target names the knative service to diagnose, the namespace defaults to "default"
+	Target = models.Target
+	// Report is the tree of resources of the service with their conditions and key information,
+	// the findings, the root cause and the warnings
+	Report = models.Report
+	// ReportNode is a resource of the tree
+	ReportNode = models.ReportNode
+	// ReportCondition is a status condition of a resource and whether it is as expected
+	ReportCondition = models.ReportCondition
+	// KeyInfo is a key field of a resource
+	KeyInfo = models.KeyInfo
+	// Finding is a condition or container state which is not as expected
+	Finding = models.Finding
+)
+
+// Options tune how the resources are loaded and reported, the zero value loads them one request at a time
+// and keeps the objects as is
+type Options struct {
+	// Concurrency bounds the number of requests sent at a time
+	Concurrency int
+	// History keeps the replicasets scaled down to 0, with a note telling why they were scaled down
+	History bool
+	// Redactor redacts the objects of the report, the conditions and key information are taken from the redacted objects
+	Redactor *utils.Redactor
+	// Cache serves the objects from a single list per resource type, when diagnosing many services of a namespace
+	Cache *Cache
+	// Warn is called with each warning as soon as it is recorded, e.g. to print it
+	Warn func(message string)
+}
+
+// Diagnose loads the resources of the target knative service through dynClient and returns the diagnosis.
+// It prints nothing. An error is returned when the service can not be loaded, the failures to load its
+// child resources are reported as warnings.
+func Diagnose(ctx context.Context, dynClient dynamic.Interface, target Target, options Options) (*Report, error) {
+	if dynClient == nil {
+		return nil, fmt.Errorf("Missing the dynamic client to contact with k8s cluster")
+	}
+	loader := NewLoader(dynClient, target, options)
+	if err := loader.Load(ctx); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if loader.root == nil {
+		return nil, fmt.Errorf("Failed to load ksvc %s in namespace %s, %s", loader.target.Service, loader.target.Namespace, strings.Join(loader.warnings, "; "))
+	}
+	return loader.Report(), nil
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnosis
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// collectFindings walks the report tree in depth-first order and returns the conditions which
+// are not as expected. Conditions without expectation are only reported for a `Ready` which is not `True`.
+func collectFindings(node *ReportNode, depth int) []Finding {
+	if node == nil {
+		return nil
+	}
+
+	findings := []Finding{}
+	for _, condition := range node.Conditions {
+		if condition.Expected == "" {
+			if condition.Type != "Ready" || condition.Status == "True" {
+				continue
+			}
+		} else if condition.AsExpected {
+			continue
+		}
+		findings = append(findings, Finding{
+			Type:    node.Type,
+			Name:    node.Name,
+			Depth:   depth,
+			Subject: condition.Type,
+			Status:  condition.Status,
+			Reason:  condition.Reason,
+			Message: condition.Message,
+		})
+	}
+	if node.Type == "pod" && node.Object != nil {
+		findings = append(findings, containerFindings(node, depth)...)
+	}
+
+	for _, child := range node.Children {
+		findings = append(findings, collectFindings(child, depth+1)...)
+	}
+	return findings
+}
+
+// containerFindings reports the containers of a pod which are waiting or terminated
+func containerFindings(node *ReportNode, depth int) []Finding {
+	findings := []Finding{}
+	statuses, _, _ := unstructured.NestedSlice(node.Object.Object, "status", "containerStatuses")
+	for _, status := range statuses {
+		m, ok := status.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, state := range []string{"waiting", "terminated"} {
+			detail, ok, _ := unstructured.NestedMap(m, "state", state)
+			if !ok {
+				continue
+			}
+			findings = append(findings, Finding{
+				Type:    node.Type,
+				Name:    node.Name,
+				Depth:   depth,
+				Subject: fmt.Sprintf("container[%v]", m["name"]),
+				Status:  state,
+				Reason:  stringValue(detail["reason"]),
+				Message: stringValue(detail["message"]),
+			})
+		}
+	}
+	return findings
+}
+
+// rootCause returns the deepest finding, the failure of a child usually explains its parents
+func rootCause(findings []Finding) *Finding {
+	if len(findings) == 0 {
+		return nil
+	}
+	deepest := findings[0]
+	for _, f := range findings[1:] {
+		if f.Depth > deepest.Depth {
+			deepest = f
+		}
+	}
+	return &deepest
+}
+
+func stringValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", v)
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnosis
+
+import (
+	"fmt"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"knative.dev/kn-plugin-diag/pkg/utils"
+)
+
+const deploymentRevisionAnnotation = "deployment.kubernetes.io/revision"
+
+// replicaSetHistory describes a scaled down replicaset: its deployment revision, its pod template hash
+// and why it was scaled down, guessed from the other replicasets and the deployment
+func replicaSetHistory(rs *unstructured.Unstructured, siblings []unstructured.Unstructured, deployment *unstructured.Unstructured) string {
+	revision := deploymentRevision(rs)
+	note := utils.JoinNonEmpty(", ",
+		labeledValue("deployment revision", rs.GetAnnotations()[deploymentRevisionAnnotation]),
+		labeledValue("pod-template-hash", rs.GetLabels()["pod-template-hash"]))
+
+	var newest *unstructured.Unstructured
+	for i := range siblings {
+		if newest == nil || deploymentRevision(&siblings[i]) > deploymentRevision(newest) {
+			newest = &siblings[i]
+		}
+	}
+	switch {
+	case newest != nil && deploymentRevision(newest) > revision:
+		return utils.JoinNonEmpty(", ", note, fmt.Sprintf("scaled down: superseded by deployment revision %s (%s)",
+			newest.GetAnnotations()[deploymentRevisionAnnotation], newest.GetName()))
+	case deployment != nil && deploymentReplicas(deployment) == 0:
+		return utils.JoinNonEmpty(", ", note, "scaled down: the deployment is scaled to zero, e.g. by the autoscaler while idle")
+	default:
+		return utils.JoinNonEmpty(", ", note, "scaled down")
+	}
+}
+
+// labeledValue returns "label value", or "" when value is not set
+func labeledValue(label, value string) string {
+	if value == "" {
+		return ""
+	}
+	return label + " " + value
+}
+
+func deploymentRevision(rs *unstructured.Unstructured) int64 {
+	revision, err := strconv.ParseInt(rs.GetAnnotations()[deploymentRevisionAnnotation], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return revision
+}
+
+// deploymentReplicas returns spec.replicas of the deployment, -1 when it is not set
+func deploymentReplicas(deployment *unstructured.Unstructured) int64 {
+	replicas, ok, _ := unstructured.NestedInt64(deployment.Object, "spec", "replicas")
+	if !ok {
+		return -1
+	}
+	return replicas
+}
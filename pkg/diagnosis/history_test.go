@@ -0,0 +1,84 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnosis
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func testReplicaSet(name, revision, hash string) unstructured.Unstructured {
+	rs := unstructured.Unstructured{Object: map[string]interface{}{}}
+	rs.SetName(name)
+	if revision != "" {
+		rs.SetAnnotations(map[string]string{deploymentRevisionAnnotation: revision})
+	}
+	if hash != "" {
+		rs.SetLabels(map[string]string{"pod-template-hash": hash})
+	}
+	return rs
+}
+
+func TestReplicaSetHistory(t *testing.T) {
+	old := testReplicaSet("hello-00001-deployment-aaa", "1", "aaa")
+	current := testReplicaSet("hello-00001-deployment-bbb", "2", "bbb")
+	scaledToZero := &unstructured.Unstructured{Object: map[string]interface{}{"spec": map[string]interface{}{"replicas": int64(0)}}}
+	running := &unstructured.Unstructured{Object: map[string]interface{}{"spec": map[string]interface{}{"replicas": int64(1)}}}
+
+	tests := []struct {
+		name       string
+		rs         unstructured.Unstructured
+		siblings   []unstructured.Unstructured
+		deployment *unstructured.Unstructured
+		want       string
+	}{
+		{
+			name:       "superseded by a newer revision",
+			rs:         old,
+			siblings:   []unstructured.Unstructured{old, current},
+			deployment: running,
+			want:       "deployment revision 1, pod-template-hash aaa, scaled down: superseded by deployment revision 2 (hello-00001-deployment-bbb)",
+		},
+		{
+			name:       "latest revision scaled to zero",
+			rs:         current,
+			siblings:   []unstructured.Unstructured{old, current},
+			deployment: scaledToZero,
+			want:       "deployment revision 2, pod-template-hash bbb, scaled down: the deployment is scaled to zero, e.g. by the autoscaler while idle",
+		},
+		{
+			name:     "latest revision without deployment",
+			rs:       current,
+			siblings: []unstructured.Unstructured{old, current},
+			want:     "deployment revision 2, pod-template-hash bbb, scaled down",
+		},
+		{
+			name:       "without revision annotation nor hash",
+			rs:         testReplicaSet("hello-00001-deployment-ccc", "", ""),
+			deployment: scaledToZero,
+			want:       "scaled down: the deployment is scaled to zero, e.g. by the autoscaler while idle",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := tt.rs
+			assert.Equal(t, replicaSetHistory(&rs, tt.siblings, tt.deployment), tt.want)
+		})
+	}
+}
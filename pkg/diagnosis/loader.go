@@ -0,0 +1,570 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnosis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"knative.dev/serving/pkg/apis/autoscaling"
+	"knative.dev/serving/pkg/apis/serving"
+
+	"knative.dev/kn-plugin-diag/pkg/models"
+)
+
+// podPageSize is the number of pods requested per page, all the pages are loaded
+const podPageSize = 500
+
+// Loader loads the resource tree of a knative service, and keeps it to refresh the parts which changed
+type Loader struct {
+	target                Target
+	dynClient             dynamic.Interface
+	options               Options
+	infos                 nodeInfos
+	crdRoot               *models.CRNode
+	root                  *models.ObjectNode
+	latestCreatedRevision string
+	fetchSlots            chan struct{}
+	//only written by the loading of the replicasets, which runs in a single goroutine
+	historyNotes map[string]string
+	ctx          context.Context
+	warningsLock sync.Mutex
+	warnings     []string
+}
+
+// NewLoader prepares the resource types of the tree of target without loading any object.
+// The namespace of target defaults to "default".
+func NewLoader(dynClient dynamic.Interface, target Target, options Options) *Loader {
+	if target.Namespace == "" {
+		target.Namespace = "default"
+	}
+	concurrency := options.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	l := &Loader{
+		target:       target,
+		dynClient:    dynClient,
+		options:      options,
+		infos:        defaultNodeInfos(),
+		fetchSlots:   make(chan struct{}, concurrency),
+		historyNotes: make(map[string]string),
+		ctx:          context.Background(),
+	}
+	l.initCRDHierarchy()
+	return l
+}
+
+// Load drops the loaded objects and loads the whole tree again. The failures to load a resource below the ksvc
+// are recorded as warnings, an error is only returned when the tree can not be walked.
+func (l *Loader) Load(ctx context.Context) error {
+	l.ctx = ctx
+	l.root = nil
+	l.latestCreatedRevision = ""
+	l.warningsLock.Lock()
+	l.warnings = nil
+	l.warningsLock.Unlock()
+	l.historyNotes = make(map[string]string)
+	return l.buildObjectHierarchy(l.crdRoot)
+}
+
+// GVRs returns the distinct GVRs of the resource types of the tree in depth-first order, e.g. to watch them
+func (l *Loader) GVRs() []schema.GroupVersionResource {
+	gvrs := []schema.GroupVersionResource{}
+	seen := make(map[schema.GroupVersionResource]bool)
+	var walk func(*models.CRNode)
+	walk = func(node *models.CRNode) {
+		if node == nil {
+			return
+		}
+		if !seen[node.GVR] {
+			seen[node.GVR] = true
+			gvrs = append(gvrs, node.GVR)
+		}
+		for _, leaf := range node.Leaves {
+			walk(leaf)
+		}
+	}
+	walk(l.crdRoot)
+	return gvrs
+}
+
+// warn records a warning for the report and passes it to Options.Warn. The loading goroutines may warn concurrently.
+func (l *Loader) warn(format string, args ...interface{}) {
+	message := strings.TrimSpace(fmt.Sprintf(format, args...))
+	l.warningsLock.Lock()
+	l.warnings = append(l.warnings, message)
+	l.warningsLock.Unlock()
+	if l.options.Warn != nil {
+		l.options.Warn(message)
+	}
+}
+
+func nodeKey(node *models.ObjectNode) string {
+	return node.CRName + "/" + node.ObjectName
+}
+
+func (l *Loader) initCRDHierarchy() {
+	ksvc := models.NewCRNode("ksvc", schema.GroupVersionResource{
+		Group:    "serving.knative.dev",
+		Version:  "v1",
+		Resource: "services"},
+		func(ksvcName string) string {
+			return ksvcName
+		})
+	configuration := models.NewCRNode("configuration", schema.GroupVersionResource{
+		Group:    "serving.knative.dev",
+		Version:  "v1",
+		Resource: "configurations",
+	}, func(ksvcName string) string {
+		return ksvcName
+	})
+	route := models.NewCRNode("route", schema.GroupVersionResource{
+		Group:    "serving.knative.dev",
+		Version:  "v1",
+		Resource: "routes",
+	}, func(ksvcName string) string {
+		return ksvcName
+	})
+	revision := models.NewCRNode("revision", schema.GroupVersionResource{
+		Group:    "serving.knative.dev",
+		Version:  "v1",
+		Resource: "revisions",
+	}, func(lastCreatedRevisionName string) string {
+		return lastCreatedRevisionName
+	})
+
+	image := models.NewCRNode("image", schema.GroupVersionResource{
+		Group:    "caching.internal.knative.dev",
+		Version:  "v1alpha1",
+		Resource: "images",
+	}, func(lastCreatedRevisionName string) string {
+		return lastCreatedRevisionName + "-cache-user-container"
+	})
+
+	deployment := models.NewCRNode("deployment", schema.GroupVersionResource{
+		Group:    "apps",
+		Version:  "v1",
+		Resource: "deployments",
+	}, func(lastCreatedRevisionName string) string {
+		return lastCreatedRevisionName + "-deployment"
+	})
+
+	replicaset := models.NewCRNode("replicaset", schema.GroupVersionResource{
+		Group:    "apps",
+		Version:  "v1",
+		Resource: "replicasets",
+	})
+	replicaset.SetListOptions(func(labels []string) metav1.ListOptions {
+		return metav1.ListOptions{
+			LabelSelector: strings.Join(labels, ","),
+		}
+	})
+
+	pod := models.NewCRNode("pod", schema.GroupVersionResource{
+		Group:    "",
+		Version:  "v1",
+		Resource: "pods",
+	})
+	pod.SetListOptions(func(labels []string) metav1.ListOptions {
+		return metav1.ListOptions{
+			LabelSelector: strings.Join(labels, ","),
+			Limit:         podPageSize,
+		}
+	})
+
+	kpa := models.NewCRNode("kpa", schema.GroupVersionResource{
+		Group:    "autoscaling.internal.knative.dev",
+		Version:  "v1alpha1",
+		Resource: "podautoscalers",
+	}, func(lastCreatedRevisionName string) string {
+		return lastCreatedRevisionName
+	})
+
+	metric := models.NewCRNode("metric", schema.GroupVersionResource{
+		Group:    "autoscaling.internal.knative.dev",
+		Version:  "v1alpha1",
+		Resource: "metrics",
+	}, func(lastCreatedRevisionName string) string {
+		return lastCreatedRevisionName
+	})
+
+	sks := models.NewCRNode("sks", schema.GroupVersionResource{
+		Group:    "networking.internal.knative.dev",
+		Version:  "v1alpha1",
+		Resource: "serverlessservices",
+	}, func(lastCreatedRevisionName string) string {
+		return lastCreatedRevisionName
+	})
+
+	hpa := models.NewCRNode("hpa", schema.GroupVersionResource{
+		Group:    "autoscaling",
+		Version:  "v2",
+		Resource: "horizontalpodautoscalers",
+	}, func(lastCreatedRevisionName string) string {
+		return lastCreatedRevisionName
+	})
+
+	publicSVC := models.NewCRNode("publicSVC", schema.GroupVersionResource{
+		Group:    "",
+		Version:  "v1",
+		Resource: "services",
+	}, func(lastCreatedRevisionName string) string {
+		return lastCreatedRevisionName
+	})
+
+	privateSVC := models.NewCRNode("privateSVC", schema.GroupVersionResource{
+		Group:    "",
+		Version:  "v1",
+		Resource: "services",
+	}, func(lastCreatedRevisionName string) string {
+		return lastCreatedRevisionName + "-private"
+	})
+
+	publicEndpoint := models.NewCRNode("publicEndpoint", schema.GroupVersionResource{
+		Group:    "",
+		Version:  "v1",
+		Resource: "endpoints",
+	}, func(lastCreatedRevisionName string) string {
+		return lastCreatedRevisionName
+	})
+
+	privateEndpoint := models.NewCRNode("privateEndpoint", schema.GroupVersionResource{
+		Group:    "",
+		Version:  "v1",
+		Resource: "endpoints",
+	}, func(lastCreatedRevisionName string) string {
+		return lastCreatedRevisionName + "-private"
+	})
+
+	externalSVC := models.NewCRNode("externalSVC", schema.GroupVersionResource{
+		Group:    "",
+		Version:  "v1",
+		Resource: "services",
+	}, func(ksvcName string) string {
+		return ksvcName
+	})
+
+	ingress := models.NewCRNode("kingress", schema.GroupVersionResource{
+		Group:    "networking.internal.knative.dev",
+		Version:  "v1alpha1",
+		Resource: "ingresses",
+	}, func(ksvcName string) string {
+		return ksvcName
+	})
+
+	ksvc.AddLeafNode(configuration)
+	ksvc.AddLeafNode(route)
+	configuration.AddLeafNode(revision)
+	revision.AddLeafNode(image)
+	revision.AddLeafNode(deployment)
+	revision.AddLeafNode(kpa)
+	deployment.AddLeafNode(replicaset)
+	replicaset.AddLeafNode(pod)
+	kpa.AddLeafNode(metric)
+	kpa.AddLeafNode(sks)
+	kpa.AddLeafNode(hpa)
+	sks.AddLeafNode(publicSVC)
+	sks.AddLeafNode(privateSVC)
+	publicSVC.AddLeafNode(publicEndpoint)
+	privateSVC.AddLeafNode(privateEndpoint)
+	route.AddLeafNode(externalSVC)
+	route.AddLeafNode(ingress)
+
+	l.crdRoot = ksvc
+
+}
+
+// buildObjectHierarchy loads the objects of crNode and of its leaves, and links them to parentObjectsNode
+func (l *Loader) buildObjectHierarchy(crNode *models.CRNode, parentObjectsNode ...*models.ObjectNode) error {
+	links, err := l.loadObjectHierarchy(crNode, parentObjectsNode...)
+	if err != nil {
+		return err
+	}
+	linkObjectNodes(links)
+	return nil
+}
+
+// objectLink attaches a loaded object to its owner object
+type objectLink struct {
+	parent *models.ObjectNode
+	child  *models.ObjectNode
+}
+
+func linkObjectNodes(links []objectLink) {
+	for _, link := range links {
+		link.parent.Leaves = append(link.parent.Leaves, link.child)
+	}
+}
+
+// loadObjectHierarchy loads the objects of crNode and returns their links to parentObjectsNode without applying them.
+// The subtrees of the leaves are loaded concurrently, and linked in the order of crNode.Leaves once all of them
+// are done, so the tree does not depend on which request returns first.
+func (l *Loader) loadObjectHierarchy(crNode *models.CRNode, parentObjectsNode ...*models.ObjectNode) ([]objectLink, error) {
+
+	if crNode == nil {
+		return nil, nil
+	}
+
+	objectNodes := []*models.ObjectNode{}
+	links := []objectLink{}
+
+	if crNode.GetResourceName == nil && crNode.GetListOptions == nil {
+		return nil, fmt.Errorf("Invalid CRD definition %s, missing both GetResourceName and GetListOptions definition.", crNode.Name)
+	}
+
+	if !l.appliesToAutoscalerClass(crNode, parentObjectsNode) {
+		return links, nil
+	}
+
+	if crNode.GetResourceName != nil {
+		objectName := ""
+		switch crNode.Name {
+		case "ksvc", "configuration", "route", "externalSVC", "kingress":
+			objectName = crNode.GetResourceName(l.target.Service)
+		default:
+			objectName = crNode.GetResourceName(l.latestCreatedRevision)
+		}
+
+		obj, err := l.getObject(crNode.GVR, objectName)
+		if err != nil {
+			l.warn("Failed to load resource %s of %s,  %v\n", crNode.Name, objectName, err)
+			return links, nil
+			//return fmt.Errorf("Failed to load resource %s of %s,  %v\n", crNode.Name, objectName, err)
+		}
+		objectNode := models.NewObjectNode(crNode.Name, objectName, obj)
+		objectNodes = append(objectNodes, objectNode)
+		//link the current object to its owner object
+		for _, parent := range parentObjectsNode {
+			links = append(links, objectLink{parent: parent, child: objectNode})
+		}
+
+		//special handling for ksvc to complete the initialization of the loader
+		if crNode.Name == "ksvc" {
+			l.root = objectNode
+			lastCreatedRevisionName, ok, err := unstructured.NestedString(obj.Object, strings.Split("status.latestCreatedRevisionName", ".")...)
+			if ok && err == nil {
+				l.latestCreatedRevision = lastCreatedRevisionName
+			} else {
+				l.warn("Failed to load the lastCreatedRevisionName from %s of %s, %v\n", crNode.Name, l.target.Service, err)
+				return links, nil
+			}
+		}
+	}
+
+	if crNode.GetListOptions != nil {
+		//handle list options for revision and pods
+		for _, parent := range parentObjectsNode {
+
+			if crNode.Name == "replicaset" {
+				listOptions := crNode.GetListOptions([]string{
+					serving.RevisionLabelKey + "=" + l.latestCreatedRevision,
+				})
+
+				objList, err := l.listObjects(crNode.GVR, listOptions)
+				if err != nil {
+					l.warn("Failed to load resource %s with label %s, %v\n", crNode.Name, listOptions.LabelSelector, err)
+					return links, nil
+				}
+				for _, obj := range objList.Items {
+					objectName, ok, err := unstructured.NestedString(obj.Object, strings.Split("metadata.name", ".")...)
+					if !ok || err != nil {
+						l.warn("Failed to load the metadata.name from %s of %s, %v\n", crNode.Name, l.target.Service, err)
+						return links, nil
+					}
+					replicaNumer, ok, err := unstructured.NestedInt64(obj.Object, strings.Split("spec.replicas", ".")...)
+					if !ok || err != nil {
+						l.warn("Failed to load the spec.replicas from %s of %s, %v\n", crNode.Name, l.target.Service, err)
+						return links, nil
+					}
+					//only count the replicaset with desired number > 0, unless the history is asked for
+					if replicaNumer > 0 || l.options.History {
+						objectNode := models.NewObjectNode(crNode.Name, objectName, &obj)
+						objectNodes = append(objectNodes, objectNode)
+						links = append(links, objectLink{parent: parent, child: objectNode})
+						if replicaNumer == 0 {
+							l.historyNotes[nodeKey(objectNode)] = replicaSetHistory(&obj, objList.Items, parent.Object)
+						}
+					}
+				}
+			} //end of if replicaset
+
+			if crNode.Name == "pod" {
+				podhash := strings.TrimPrefix(parent.ObjectName, l.latestCreatedRevision+"-deployment-")
+				listOptions := crNode.GetListOptions([]string{
+					serving.RevisionLabelKey + "=" + l.latestCreatedRevision,
+					"pod-template-hash" + "=" + podhash,
+				})
+
+				//load all the pages, the pods are summarized when printed instead of being truncated
+				objList, err := l.listObjects(crNode.GVR, listOptions)
+				for err == nil && objList.GetContinue() != "" {
+					listOptions.Continue = objList.GetContinue()
+					var page *unstructured.UnstructuredList
+					page, err = l.listObjects(crNode.GVR, listOptions)
+					if err == nil {
+						objList.Items = append(objList.Items, page.Items...)
+						objList.SetContinue(page.GetContinue())
+					}
+				}
+				if err != nil {
+					l.warn("Failed to load resource %s with label %s, %v\n", crNode.Name, listOptions.LabelSelector, err)
+					return links, nil
+				}
+				for _, obj := range objList.Items {
+					objectName, ok, err := unstructured.NestedString(obj.Object, strings.Split("metadata.name", ".")...)
+					if !ok || err != nil {
+						l.warn("Failed to load the metadata.name for %s %s, %v\n", crNode.Name, l.target.Service, err)
+						return links, nil
+					}
+					objectNode := models.NewObjectNode(crNode.Name, objectName, &obj)
+					objectNodes = append(objectNodes, objectNode)
+					links = append(links, objectLink{parent: parent, child: objectNode})
+				}
+			} //end of `if pod`
+
+		} //end of `for parent`
+	} //end of `if listOptions`
+
+	leafLinks := make([][]objectLink, len(crNode.Leaves))
+	leafErrs := make([]error, len(crNode.Leaves))
+	var wg sync.WaitGroup
+	for i, leaf := range crNode.Leaves {
+		wg.Add(1)
+		go func(i int, leaf *models.CRNode) {
+			defer wg.Done()
+			leafLinks[i], leafErrs[i] = l.loadObjectHierarchy(leaf, objectNodes...)
+		}(i, leaf)
+	}
+	wg.Wait()
+
+	for i := range crNode.Leaves {
+		if leafErrs[i] != nil {
+			return nil, leafErrs[i]
+		}
+		linkObjectNodes(leafLinks[i])
+	}
+
+	return links, nil
+
+}
+
+// getObject gets an object once a fetch slot is free, so that at most Options.Concurrency requests run at a time
+func (l *Loader) getObject(gvr schema.GroupVersionResource, name string) (*unstructured.Unstructured, error) {
+	l.fetchSlots <- struct{}{}
+	defer func() { <-l.fetchSlots }()
+	if l.options.Cache != nil {
+		return l.options.Cache.get(l.ctx, gvr, l.target.Namespace, name)
+	}
+	return l.dynClient.Resource(gvr).Namespace(l.target.Namespace).Get(l.ctx, name, metav1.GetOptions{})
+}
+
+// listObjects lists objects once a fetch slot is free
+func (l *Loader) listObjects(gvr schema.GroupVersionResource, listOptions metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	l.fetchSlots <- struct{}{}
+	defer func() { <-l.fetchSlots }()
+	if l.options.Cache != nil {
+		return l.options.Cache.list(l.ctx, gvr, l.target.Namespace, listOptions)
+	}
+	return l.dynClient.Resource(gvr).Namespace(l.target.Namespace).List(l.ctx, listOptions)
+}
+
+// Refresh reloads the object subtrees of the resource types whose GVR is in changed, e.g. the ones a watch
+// saw changing. A change of the ksvc itself may move the latest created revision, so the whole tree is loaded again.
+func (l *Loader) Refresh(ctx context.Context, changed map[schema.GroupVersionResource]bool) error {
+	if changed[l.crdRoot.GVR] || l.root == nil {
+		return l.Load(ctx)
+	}
+	l.ctx = ctx
+	return l.refreshCRNode(l.crdRoot, changed)
+}
+
+func (l *Loader) refreshCRNode(crNode *models.CRNode, changed map[schema.GroupVersionResource]bool) error {
+	for _, leaf := range crNode.Leaves {
+		if !changed[leaf.GVR] {
+			if err := l.refreshCRNode(leaf, changed); err != nil {
+				return err
+			}
+			continue
+		}
+		//drop the outdated objects of the leaf, together with their subtrees, and load them again
+		parents := l.findObjectNodes(l.root, crNode.Name)
+		for _, parent := range parents {
+			leaves := []*models.ObjectNode{}
+			for _, objectNode := range parent.Leaves {
+				if objectNode.CRName != leaf.Name {
+					leaves = append(leaves, objectNode)
+					continue
+				}
+				l.dropHistoryNotes(objectNode)
+			}
+			parent.Leaves = leaves
+		}
+		if err := l.buildObjectHierarchy(leaf, parents...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropHistoryNotes forgets the history notes of an outdated object and of its subtree, a replicaset
+// scaled up again must not keep the note of why it was scaled down
+func (l *Loader) dropHistoryNotes(node *models.ObjectNode) {
+	delete(l.historyNotes, nodeKey(node))
+	for _, leaf := range node.Leaves {
+		l.dropHistoryNotes(leaf)
+	}
+}
+
+func (l *Loader) findObjectNodes(node *models.ObjectNode, crName string) []*models.ObjectNode {
+	if node == nil {
+		return nil
+	}
+	found := []*models.ObjectNode{}
+	if node.CRName == crName {
+		found = append(found, node)
+	}
+	for _, leaf := range node.Leaves {
+		found = append(found, l.findObjectNodes(leaf, crName)...)
+	}
+	return found
+}
+
+// appliesToAutoscalerClass tells whether the objects of crNode exist for the class of the parent PodAutoscaler.
+// The HorizontalPodAutoscaler only backs the hpa class, which collects no Metric unless it scales on
+// concurrency or rps.
+func (l *Loader) appliesToAutoscalerClass(crNode *models.CRNode, parentObjectsNode []*models.ObjectNode) bool {
+	if crNode.Name != "hpa" && crNode.Name != "metric" {
+		return true
+	}
+	if len(parentObjectsNode) == 0 || parentObjectsNode[0].Object == nil {
+		return crNode.Name != "hpa"
+	}
+	annotations := parentObjectsNode[0].Object.GetAnnotations()
+	isHPA := autoscaling.ClassAnnotation.Value(annotations) == autoscaling.HPA
+	if crNode.Name == "hpa" {
+		return isHPA
+	}
+	metric := autoscaling.MetricAnnotation.Value(annotations)
+	return !isHPA || metric == autoscaling.Concurrency || metric == autoscaling.RPS
+}
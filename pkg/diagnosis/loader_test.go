@@ -0,0 +1,117 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnosis
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+// countingClient counts the requests in flight, each one taking delay
+type countingClient struct {
+	dynamic.Interface
+	delay       time.Duration
+	lock        sync.Mutex
+	inFlight    int
+	maxInFlight int
+}
+
+type countingResource struct {
+	dynamic.NamespaceableResourceInterface
+	client *countingClient
+}
+
+type countingNamespacedResource struct {
+	dynamic.ResourceInterface
+	client *countingClient
+}
+
+func (c *countingClient) Resource(gvr schema.GroupVersionResource) dynamic.NamespaceableResourceInterface {
+	return &countingResource{c.Interface.Resource(gvr), c}
+}
+
+func (r *countingResource) Namespace(namespace string) dynamic.ResourceInterface {
+	return &countingNamespacedResource{r.NamespaceableResourceInterface.Namespace(namespace), r.client}
+}
+
+func (c *countingClient) request() func() {
+	c.lock.Lock()
+	c.inFlight++
+	if c.inFlight > c.maxInFlight {
+		c.maxInFlight = c.inFlight
+	}
+	c.lock.Unlock()
+	time.Sleep(c.delay)
+	return func() {
+		c.lock.Lock()
+		c.inFlight--
+		c.lock.Unlock()
+	}
+}
+
+func (r *countingNamespacedResource) Get(ctx context.Context, name string, options metav1.GetOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	defer r.client.request()()
+	return r.ResourceInterface.Get(ctx, name, options, subresources...)
+}
+
+func (r *countingNamespacedResource) List(ctx context.Context, options metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	defer r.client.request()()
+	return r.ResourceInterface.List(ctx, options)
+}
+
+func TestLoaderConcurrency(t *testing.T) {
+	object := func(kind string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion("serving.knative.dev/v1")
+		obj.SetKind(kind)
+		obj.SetNamespace("demo")
+		obj.SetName("hello")
+		return obj
+	}
+	tests := []struct {
+		name        string
+		concurrency int
+		wantMax     int
+	}{
+		{name: "sequential by default", concurrency: 0, wantMax: 1},
+		{name: "sequential", concurrency: 1, wantMax: 1},
+		{name: "bounded", concurrency: 2, wantMax: 2},
+		//the subtrees of the configuration and of the route are walked concurrently, three requests overlap at most
+		{name: "concurrent siblings", concurrency: 8, wantMax: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dynClient := &countingClient{
+				Interface: fake.NewSimpleDynamicClient(runtime.NewScheme(), testKsvc(), object("Configuration"), object("Route")),
+				delay:     50 * time.Millisecond,
+			}
+			loader := NewLoader(dynClient, Target{Service: "hello", Namespace: "demo"}, Options{Concurrency: tt.concurrency})
+			assert.NilError(t, loader.Load(context.Background()))
+			assert.Equal(t, dynClient.maxInFlight, tt.wantMax)
+		})
+	}
+}
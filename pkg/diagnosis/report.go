@@ -0,0 +1,184 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnosis
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"knative.dev/kn-plugin-diag/pkg/models"
+	"knative.dev/kn-plugin-diag/pkg/utils"
+)
+
+// nodeInfos are the key info paths and the expected conditions of every resource type
+type nodeInfos struct {
+	keyInfos       map[string][]models.KeyInfoPath
+	conditionInfos map[string][]models.ConditionInfo
+}
+
+func defaultNodeInfos() nodeInfos {
+	return nodeInfos{
+		keyInfos:       models.LoadServingKeyInfoConfiguration(),
+		conditionInfos: models.LoadServingConditionInfoConfiguration(),
+	}
+}
+
+// Report returns the loaded tree with the findings and the warnings, redacted when Options.Redactor is set.
+// The objects of the report are the loaded ones, a later Load or Refresh does not change them.
+func (l *Loader) Report() *Report {
+	report := &Report{
+		Target:                l.target,
+		LatestCreatedRevision: l.latestCreatedRevision,
+		Root:                  l.reportNode(l.root),
+	}
+	l.warningsLock.Lock()
+	report.Warnings = append(report.Warnings, l.warnings...)
+	l.warningsLock.Unlock()
+	report.Warnings = append(report.Warnings, keyInfoWarnings(report.Root)...)
+	if l.options.Redactor != nil {
+		return Redact(report, l.options.Redactor)
+	}
+	addFindings(report)
+	return report
+}
+
+func (l *Loader) reportNode(node *models.ObjectNode) *ReportNode {
+	if node == nil {
+		return nil
+	}
+	reportNode := &ReportNode{
+		Type:   node.CRName,
+		Name:   node.ObjectName,
+		Object: node.Object,
+		Note:   l.historyNotes[nodeKey(node)],
+	}
+	l.infos.describe(reportNode)
+	for _, leaf := range node.Leaves {
+		reportNode.Children = append(reportNode.Children, l.reportNode(leaf))
+	}
+	return reportNode
+}
+
+// describe fills the creation time, the conditions and the key info of node from its object
+func (infos nodeInfos) describe(node *ReportNode) {
+	node.CreatedAt, node.Conditions, node.KeyInfo, node.Warnings = "", nil, nil, nil
+	if node.Object == nil {
+		return
+	}
+	node.CreatedAt, _, _ = unstructured.NestedString(node.Object.Object, "metadata", "creationTimestamp")
+
+	expectations := make(map[string]string)
+	for _, info := range infos.conditionInfos[node.Type] {
+		expectations[info.Type] = info.Expected
+	}
+	conditions, _, _ := unstructured.NestedSlice(node.Object.Object, "status", "conditions")
+	for _, condition := range conditions {
+		m, ok := condition.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		conditionType, status := stringValue(m["type"]), stringValue(m["status"])
+		expected := expectations[conditionType]
+		node.Conditions = append(node.Conditions, ReportCondition{
+			Type:               conditionType,
+			Status:             status,
+			Reason:             stringValue(m["reason"]),
+			Message:            stringValue(m["message"]),
+			LastTransitionTime: stringValue(m["lastTransitionTime"]),
+			Expected:           expected,
+			AsExpected:         len(expected) == 0 || strings.Contains(expected, status),
+		})
+	}
+
+	rows, warnings := infos.keyInfoRows(node)
+	node.Warnings = warnings
+	for _, row := range rows {
+		node.KeyInfo = append(node.KeyInfo, KeyInfo{Key: row[0], Value: row[1]})
+	}
+}
+
+// keyInfoRows returns the key and value pairs of the key info configuration of the node type, in order,
+// and the warnings about the paths which could not be read
+func (infos nodeInfos) keyInfoRows(node *ReportNode) ([][]string, []string) {
+	keyInfo, ok := infos.keyInfos[node.Type]
+	if !ok {
+		return nil, nil
+	}
+	res := utils.NewPrintableResource(0, node.Type, node.Name, utils.WithVerboseType("keyinfo"), utils.WithQuiet(true))
+	if err := res.AddKeyInfo(keyInfo, models.NewObjectNode(node.Type, node.Name, node.Object)); err != nil {
+		return nil, res.Warnings()
+	}
+	rows := [][]string{}
+	for _, row := range res.KeyInfoRows() {
+		if len(row) == 2 {
+			rows = append(rows, row)
+		}
+	}
+	return rows, res.Warnings()
+}
+
+// keyInfoWarnings returns the key info warnings of the tree of node in depth-first order
+func keyInfoWarnings(node *ReportNode) []string {
+	if node == nil {
+		return nil
+	}
+	warnings := append([]string{}, node.Warnings...)
+	for _, child := range node.Children {
+		warnings = append(warnings, keyInfoWarnings(child)...)
+	}
+	return warnings
+}
+
+// Redact returns a copy of report whose objects are redacted by redactor, with the conditions, key info and
+// findings taken from the redacted objects. The tree of the copy has the shape of the one of report.
+func Redact(report *Report, redactor *utils.Redactor) *Report {
+	redacted := &Report{
+		Target:                report.Target,
+		LatestCreatedRevision: report.LatestCreatedRevision,
+		Warnings:              report.Warnings,
+	}
+	if redactor == nil {
+		redacted.Root = copyTree(report.Root, nil, nodeInfos{})
+	} else {
+		redacted.Root = copyTree(report.Root, redactor, defaultNodeInfos())
+	}
+	addFindings(redacted)
+	return redacted
+}
+
+func copyTree(node *ReportNode, redactor *utils.Redactor, infos nodeInfos) *ReportNode {
+	if node == nil {
+		return nil
+	}
+	copied := *node
+	copied.Children = nil
+	if redactor != nil && node.Object != nil {
+		copied.Object = node.Object.DeepCopy()
+		redactor.RedactObject(copied.Object.Object)
+		infos.describe(&copied)
+	}
+	for _, child := range node.Children {
+		copied.Children = append(copied.Children, copyTree(child, redactor, infos))
+	}
+	return &copied
+}
+
+func addFindings(report *Report) {
+	report.Findings = collectFindings(report.Root, 0)
+	report.RootCause = rootCause(report.Findings)
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnosis
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/fake"
+
+	"knative.dev/kn-plugin-diag/pkg/utils"
+)
+
+const testFailure = "failed to connect to postgres://admin:s3cret@db:5432/app"
+
+func testKsvc() *unstructured.Unstructured {
+	ksvc := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "serving.knative.dev/v1",
+		"kind":       "Service",
+		"metadata":   map[string]interface{}{"creationTimestamp": "2021-06-01T10:00:00Z"},
+		"status": map[string]interface{}{
+			"latestCreatedRevisionName": "hello-00001",
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Ready", "status": "False", "reason": "RevisionFailed", "message": testFailure},
+			},
+		},
+	}}
+	ksvc.SetName("hello")
+	ksvc.SetNamespace("demo")
+	return ksvc
+}
+
+func TestDiagnose(t *testing.T) {
+	dynClient := fake.NewSimpleDynamicClient(runtime.NewScheme(), testKsvc())
+
+	report, err := Diagnose(context.Background(), dynClient, Target{Service: "hello", Namespace: "demo"}, Options{})
+	assert.NilError(t, err)
+	assert.Equal(t, report.LatestCreatedRevision, "hello-00001")
+	assert.Equal(t, report.Root.Type, "ksvc")
+	assert.Equal(t, report.Root.CreatedAt, "2021-06-01T10:00:00Z")
+	assert.Equal(t, report.RootCause.String(), "ksvc hello: Ready=False RevisionFailed: "+testFailure)
+	//the configuration and the route are missing, loaded concurrently, then the key info of the ksvc without spec
+	loadWarnings := append([]string{}, report.Warnings[:2]...)
+	sort.Strings(loadWarnings)
+	assert.DeepEqual(t, loadWarnings, []string{
+		`Failed to load resource configuration of hello,  configurations.serving.knative.dev "hello" not found`,
+		`Failed to load resource route of hello,  routes.serving.knative.dev "hello" not found`,
+	})
+	assert.Assert(t, len(report.Root.Warnings) != 0)
+	assert.DeepEqual(t, report.Warnings[2:], report.Root.Warnings)
+
+	_, err = Diagnose(context.Background(), dynClient, Target{Service: "bye", Namespace: "demo"}, Options{})
+	assert.ErrorContains(t, err, "Failed to load ksvc bye in namespace demo")
+}
+
+func TestRedact(t *testing.T) {
+	redactor, err := utils.NewRedactor(nil)
+	assert.NilError(t, err)
+	redactedFailure := redactor.RedactText(testFailure)
+	assert.Assert(t, redactedFailure != testFailure)
+
+	report := &Report{Target: Target{Service: "hello", Namespace: "demo"}, Root: &ReportNode{Type: "ksvc", Name: "hello", Object: testKsvc()}}
+	defaultNodeInfos().describe(report.Root)
+	addFindings(report)
+
+	redacted := Redact(report, redactor)
+	assert.Equal(t, redacted.Root.Conditions[0].Message, redactedFailure)
+	assert.Equal(t, redacted.RootCause.Message, redactedFailure)
+	conditions, _, _ := unstructured.NestedSlice(redacted.Root.Object.Object, "status", "conditions")
+	assert.Equal(t, conditions[0].(map[string]interface{})["message"], redactedFailure)
+	//the report is left as is
+	assert.Equal(t, report.Root.Conditions[0].Message, testFailure)
+	assert.Equal(t, report.RootCause.Message, testFailure)
+
+	copied := Redact(report, nil)
+	assert.Equal(t, copied.RootCause.Message, testFailure)
+	assert.Assert(t, copied.Root != report.Root)
+}
@@ -139,6 +139,22 @@ func defaultServingConditionConfiguration() []byte {
 		"conditionInfos": [
 		]
 	},
+	{
+		"name": "hpa",
+		"conditionInfos": [
+			{
+				"type": "AbleToScale",
+				"expected":"True"
+			},
+			{
+				"type": "ScalingActive",
+				"expected":"True"
+			},
+			{
+				"type": "ScalingLimited"
+			}
+		]
+	},
 	{
 		"name": "sks",
 		"conditionInfos": [
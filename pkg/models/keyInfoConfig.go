@@ -22,12 +22,35 @@ import (
 )
 
 type KeyInfoConfiguration struct {
-	Name     string   `json:"name"`
-	KeyInfos []string `json:"keyInfos"`
+	Name     string        `json:"name"`
+	KeyInfos []KeyInfoPath `json:"keyInfos"`
+}
+
+// KeyInfoPath is a key info definition, either a dotted path with [*] for slices, e.g. "spec.containers[*].image",
+// or a client-go JSONPath, e.g. `{.spec.containers[?(@.name=="user-container")].image}`.
+// It is written as a plain string, or as an object to show the values under a label.
+type KeyInfoPath struct {
+	Path  string `json:"path"`
+	Label string `json:"label,omitempty"`
+}
+
+func (p *KeyInfoPath) UnmarshalJSON(data []byte) error {
+	var path string
+	if err := json.Unmarshal(data, &path); err == nil {
+		*p = KeyInfoPath{Path: path}
+		return nil
+	}
+	type keyInfoPath KeyInfoPath
+	var v keyInfoPath
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*p = KeyInfoPath(v)
+	return nil
 }
 
 func defaultServingKeyInfoConfiguration() []byte {
-	//support slice by [*] only
+	//a key info is a dotted path with [*] for slices, a JSONPath, or {"path": ..., "label": ...}
 	configurationJSON := `
 [
 	{
@@ -112,6 +135,17 @@ func defaultServingKeyInfoConfiguration() []byte {
 			"spec.scrapeTarget"
 		]
 	},
+	{
+		"name": "hpa",
+		"keyInfos": [
+			"spec.minReplicas",
+			"spec.maxReplicas",
+			"spec.metrics",
+			"status.currentReplicas",
+			"status.desiredReplicas",
+			"status.currentMetrics"
+		]
+	},
 	{
 		"name": "sks",
 		"keyInfos": [
@@ -185,14 +219,14 @@ func defaultServingKeyInfoConfiguration() []byte {
 	return []byte(configurationJSON)
 }
 
-func LoadServingKeyInfoConfiguration() map[string][]string {
+func LoadServingKeyInfoConfiguration() map[string][]KeyInfoPath {
 
 	var configurations []KeyInfoConfiguration
 	if err := json.Unmarshal(defaultServingKeyInfoConfiguration(), &configurations); err != nil {
 		log.Fatal(err)
 	}
 
-	keyinfoMap := make(map[string][]string)
+	keyinfoMap := make(map[string][]KeyInfoPath)
 	for _, item := range configurations {
 		if _, ok := keyinfoMap[item.Name]; !ok {
 			keyinfoMap[item.Name] = item.KeyInfos
@@ -0,0 +1,99 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Target names the knative service to diagnose
+type Target struct {
+	Service   string `json:"service"`
+	Namespace string `json:"namespace"`
+}
+
+// Report is the structured diagnosis of a knative service, free of any rendering
+type Report struct {
+	Target Target `json:"target"`
+	// LatestCreatedRevision is the status.latestCreatedRevisionName of the ksvc, whose resources are in the tree
+	LatestCreatedRevision string `json:"latestCreatedRevision,omitempty"`
+	// Root is the ksvc node of the resource tree
+	Root *ReportNode `json:"root,omitempty"`
+	// Findings are the conditions and container states which are not as expected, in depth-first order
+	Findings []Finding `json:"findings,omitempty"`
+	// RootCause is the deepest finding, the failure of a child usually explains its parents
+	RootCause *Finding `json:"rootCause,omitempty"`
+	// Warnings are the resources or fields which failed to load, the key info warnings of the nodes included
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// ReportNode is a resource of the tree with its conditions and key information
+type ReportNode struct {
+	Type       string            `json:"type"`
+	Name       string            `json:"name"`
+	CreatedAt  string            `json:"createdAt,omitempty"`
+	Conditions []ReportCondition `json:"conditions,omitempty"`
+	KeyInfo    []KeyInfo         `json:"keyInfo,omitempty"`
+	// Note tells why a replicaset kept for the history was scaled down to 0
+	Note string `json:"note,omitempty"`
+	// Warnings are the key info paths of the resource which could not be read
+	Warnings []string                   `json:"warnings,omitempty"`
+	Children []*ReportNode              `json:"children,omitempty"`
+	Object   *unstructured.Unstructured `json:"-"`
+}
+
+// ReportCondition is a status condition and whether it matches the expected status
+type ReportCondition struct {
+	Type               string `json:"type"`
+	Status             string `json:"status"`
+	Reason             string `json:"reason,omitempty"`
+	Message            string `json:"message,omitempty"`
+	LastTransitionTime string `json:"lastTransitionTime,omitempty"`
+	Expected           string `json:"expected,omitempty"`
+	AsExpected         bool   `json:"asExpected"`
+}
+
+// KeyInfo is a field picked by the key info configuration of the resource type
+type KeyInfo struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Finding is a condition or container state of a resource that is not as expected
+type Finding struct {
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Depth   int    `json:"depth"`
+	Subject string `json:"subject"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// String formats the finding as `type name: subject=status reason: message`
+func (f Finding) String() string {
+	s := fmt.Sprintf("%s %s: %s=%s", f.Type, f.Name, f.Subject, f.Status)
+	if f.Reason != "" {
+		s = s + " " + f.Reason
+	}
+	if f.Message != "" {
+		s = s + ": " + f.Message
+	}
+	return s
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
+)
+
+const ansiReset = "\x1b[0m"
+
+// ansiEscape matches the SGR escape codes used to colorize the output
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// InitColor turns the colors off for --no-color, when NO_COLOR is set or when stdout is not a terminal
+func InitColor(noColor bool) {
+	if noColor || os.Getenv("NO_COLOR") != "" || !IsTerminal(os.Stdout) {
+		color.NoColor = true
+	}
+}
+
+// IsTerminal tells whether w writes to a terminal, a redirected output is not one
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
+
+// VisibleWidth returns the number of runes of s shown on the screen, the escape codes are not counted
+func VisibleWidth(s string) int {
+	return utf8.RuneCountInString(ansiEscape.ReplaceAllString(s, ""))
+}
+
+// SplitVisible splits s after width visible runes without cutting an escape code. A color open at the
+// split is reset at the end of the head and opened again at the start of the tail.
+func SplitVisible(s string, width int) (string, string) {
+	var head strings.Builder
+	active := []string{}
+	visible := 0
+	i := 0
+	for i < len(s) && visible < width {
+		if loc := ansiEscape.FindStringIndex(s[i:]); loc != nil && loc[0] == 0 {
+			code := s[i : i+loc[1]]
+			if code == ansiReset {
+				active = active[:0]
+			} else {
+				active = append(active, code)
+			}
+			head.WriteString(code)
+			i += loc[1]
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		head.WriteString(s[i : i+size])
+		i += size
+		visible++
+	}
+	//the codes right after the split belong to the tail, except the resets closing the head
+	for strings.HasPrefix(s[i:], ansiReset) {
+		head.WriteString(ansiReset)
+		active = active[:0]
+		i += len(ansiReset)
+	}
+	if len(active) == 0 {
+		return head.String(), s[i:]
+	}
+	head.WriteString(ansiReset)
+	return head.String(), strings.Join(active, "") + s[i:]
+}
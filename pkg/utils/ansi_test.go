@@ -0,0 +1,52 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestSplitVisible(t *testing.T) {
+	red, bold := "\x1b[31m", "\x1b[1m"
+	tests := []struct {
+		name  string
+		s     string
+		width int
+		head  string
+		tail  string
+	}{
+		{"plain text", "hello world", 5, "hello", " world"},
+		{"shorter than the width", "hello", 10, "hello", ""},
+		{"zero width", "hello", 0, "", "hello"},
+		{"multibyte runes", "héllo wörld", 7, "héllo w", "örld"},
+		{"color closed before the split", red + "ab" + ansiReset + "cdef", 3, red + "ab" + ansiReset + "c", "def"},
+		{"color open at the split", red + "abcdef" + ansiReset, 3, red + "abc" + ansiReset, red + "def" + ansiReset},
+		{"nested colors open at the split", red + bold + "abcdef" + ansiReset, 2, red + bold + "ab" + ansiReset, red + bold + "cdef" + ansiReset},
+		{"reset right after the split", red + "abc" + ansiReset + "def", 3, red + "abc" + ansiReset, "def"},
+		{"color opened right after the split", "abc" + red + "def" + ansiReset, 3, "abc", red + "def" + ansiReset},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			head, tail := SplitVisible(tt.s, tt.width)
+			assert.Equal(t, head, tt.head)
+			assert.Equal(t, tail, tt.tail)
+			assert.Equal(t, VisibleWidth(head)+VisibleWidth(tail), VisibleWidth(tt.s))
+		})
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/spf13/pflag"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -30,6 +31,20 @@ type ConnectionConfig struct {
 	KubeCfgPath  string
 	ClientConfig clientcmd.ClientConfig
 	ClientSet    *kubernetes.Clientset
+	// Overrides are applied on top of the kubeconfig, e.g. the context, cluster or user to use
+	Overrides clientcmd.ConfigOverrides
+	// QPS and Burst throttle the requests on the client side, the client-go defaults apply when not set
+	QPS   float32
+	Burst int
+}
+
+// AddFlags binds --kubeconfig and the standard client-go override flags, e.g. --context, --cluster, --user,
+// --as, --request-timeout or --insecure-skip-tls-verify. The namespace flag is left to each command.
+func (params *ConnectionConfig) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&params.KubeCfgPath, "kubeconfig", "", "Path to the kubeconfig file to use")
+	flagNames := clientcmd.RecommendedConfigOverrideFlags("")
+	flagNames.ContextOverrideFlags.Namespace = clientcmd.FlagInfo{}
+	clientcmd.BindOverrideFlags(&params.Overrides, flags, flagNames)
 }
 
 func (params *ConnectionConfig) Initialize() error {
@@ -63,21 +78,60 @@ func (params *ConnectionConfig) RestConfig() (*rest.Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	if params.QPS > 0 {
+		config.QPS = params.QPS
+	}
+	if params.Burst > 0 {
+		config.Burst = params.Burst
+	}
 
 	return config, nil
 }
 
+// ContextNamespace returns the namespace of the client configuration: the overrides, the current kubeconfig context
+// or the namespace of the service account when running in a pod. It returns "" when none of them sets one, so that
+// the caller can fall back to its own default.
+func (params *ConnectionConfig) ContextNamespace() string {
+	if params.ClientConfig == nil {
+		clientConfig, err := params.GetClientConfig()
+		if err != nil {
+			return ""
+		}
+		params.ClientConfig = clientConfig
+	}
+	namespace, overridden, err := params.ClientConfig.Namespace()
+	if err != nil || namespace == "" {
+		return ""
+	}
+	if overridden || namespace != "default" {
+		return namespace
+	}
+	//"default" is also returned when nothing sets the namespace, keep it only when the context sets it
+	rawConfig, err := params.ClientConfig.RawConfig()
+	if err != nil {
+		return ""
+	}
+	contextName := rawConfig.CurrentContext
+	if params.Overrides.CurrentContext != "" {
+		contextName = params.Overrides.CurrentContext
+	}
+	if context, ok := rawConfig.Contexts[contextName]; ok && context.Namespace != "" {
+		return namespace
+	}
+	return ""
+}
+
 // GetClientConfig gets ClientConfig from KubeCfgPath
 func (params *ConnectionConfig) GetClientConfig() (clientcmd.ClientConfig, error) {
 	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
 	if len(params.KubeCfgPath) == 0 {
-		return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{}), nil
+		return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &params.Overrides), nil
 	}
 
 	_, err := os.Stat(params.KubeCfgPath)
 	if err == nil {
 		loadingRules.ExplicitPath = params.KubeCfgPath
-		return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{}), nil
+		return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &params.Overrides), nil
 	}
 
 	if !os.IsNotExist(err) {
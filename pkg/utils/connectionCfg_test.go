@@ -0,0 +1,138 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"gotest.tools/v3/assert"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+const testKubeConfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: dev
+  cluster:
+    server: https://dev.example.com
+- name: prod
+  cluster:
+    server: https://prod.example.com
+users:
+- name: admin
+  user:
+    token: t0ken
+contexts:
+- name: dev
+  context:
+    cluster: dev
+    user: admin
+    namespace: demo
+- name: prod
+  context:
+    cluster: prod
+    user: admin
+current-context: dev
+`
+
+func writeKubeConfig(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	assert.NilError(t, os.WriteFile(path, []byte(testKubeConfig), 0600))
+	return path
+}
+
+func TestRestConfigThrottling(t *testing.T) {
+	tests := []struct {
+		name      string
+		qps       float32
+		burst     int
+		wantQPS   float32
+		wantBurst int
+	}{
+		{name: "client-go defaults", qps: 0, burst: 0, wantQPS: 0, wantBurst: 0},
+		{name: "flags", qps: 50, burst: 100, wantQPS: 50, wantBurst: 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := &ConnectionConfig{KubeCfgPath: writeKubeConfig(t), QPS: tt.qps, Burst: tt.burst}
+			config, err := params.RestConfig()
+			assert.NilError(t, err)
+			assert.Equal(t, config.QPS, tt.wantQPS)
+			assert.Equal(t, config.Burst, tt.wantBurst)
+		})
+	}
+}
+
+func TestAddFlagsOverrides(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		wantHost    string
+		wantUser    string
+		wantTimeout time.Duration
+	}{
+		{name: "current context", wantHost: "https://dev.example.com"},
+		{name: "context flag", args: []string{"--context", "prod"}, wantHost: "https://prod.example.com"},
+		{name: "server and impersonation flags", args: []string{"--server", "https://other.example.com", "--as", "bob", "--request-timeout", "5s"},
+			wantHost: "https://other.example.com", wantUser: "bob", wantTimeout: 5 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := &ConnectionConfig{}
+			flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			params.AddFlags(flags)
+			assert.NilError(t, flags.Parse(append([]string{"--kubeconfig", writeKubeConfig(t)}, tt.args...)))
+
+			config, err := params.RestConfig()
+			assert.NilError(t, err)
+			assert.Equal(t, config.Host, tt.wantHost)
+			assert.Equal(t, config.Impersonate.UserName, tt.wantUser)
+			assert.Equal(t, config.Timeout, tt.wantTimeout)
+		})
+	}
+}
+
+func TestAddFlagsLeavesNamespace(t *testing.T) {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	(&ConnectionConfig{}).AddFlags(flags)
+	assert.Assert(t, flags.Lookup("namespace") == nil)
+	assert.Assert(t, flags.Lookup("context") != nil)
+}
+
+func TestContextNamespace(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides clientcmd.ConfigOverrides
+		want      string
+	}{
+		{name: "namespace of the current context", want: "demo"},
+		{name: "context without namespace", overrides: clientcmd.ConfigOverrides{CurrentContext: "prod"}, want: ""},
+		{name: "namespace override", overrides: clientcmd.ConfigOverrides{Context: clientcmdapi.Context{Namespace: "other"}}, want: "other"},
+		{name: "default namespace override", overrides: clientcmd.ConfigOverrides{CurrentContext: "prod", Context: clientcmdapi.Context{Namespace: "default"}}, want: "default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := &ConnectionConfig{KubeCfgPath: writeKubeConfig(t), Overrides: tt.overrides}
+			assert.Equal(t, params.ContextNamespace(), tt.want)
+		})
+	}
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// KnConfig holds the defaults read from the kn config file
+type KnConfig struct {
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// IsKnPlugin tells whether the binary is run as a kn plugin, which kn finds by the kn- prefix of its name
+func IsKnPlugin() bool {
+	return strings.HasPrefix(filepath.Base(os.Args[0]), "kn-")
+}
+
+// KnConfigPath returns the path of the kn config file, ~/.config/kn/config.yaml by default
+func KnConfigPath() string {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		configHome = filepath.Join(home, ".config")
+	}
+	return filepath.Join(configHome, "kn", "config.yaml")
+}
+
+// LoadKnConfig reads the kn config file, a missing or invalid file means no defaults
+func LoadKnConfig() KnConfig {
+	config := KnConfig{}
+	path := KnConfigPath()
+	if path == "" {
+		return config
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		SayWarningMessage("Failed to parse the kn config %s, %v\n", path, err)
+	}
+	return config
+}
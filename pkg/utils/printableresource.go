@@ -19,14 +19,19 @@ package utils
 import (
 	"fmt"
 	"os"
+	"regexp"
 	"strings"
 
 	. "knative.dev/kn-plugin-diag/pkg/models"
 
 	"github.com/fatih/color"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/jsonpath"
 )
 
+// dottedKeyInfoPath matches the key info paths made of dotted fields and [*], any other path is a JSONPath
+var dottedKeyInfoPath = regexp.MustCompile(`^[^.\[\]{}$@?][^\[\]{}$@?]*(\[\*\][^\[\]{}$@?]*)*$`)
+
 type PrintableResource struct {
 	level            int
 	typeName         string
@@ -37,6 +42,11 @@ type PrintableResource struct {
 	keyInfo          [][]string
 	conditions       [][]string
 	verboseType      string
+	highlighted      bool
+	deemphasized     bool
+	quiet            bool
+	columns          []string
+	warnings         []string
 }
 
 type Option func(PrintableResource) PrintableResource
@@ -88,14 +98,70 @@ func WithVerboseType(verboseType string) Option {
 	}
 }
 
+// WithHighlighted marks the resource as changed, its type name is colorized in the dump
+func WithHighlighted(highlighted bool) Option {
+	return func(res PrintableResource) PrintableResource {
+		res.highlighted = highlighted
+		return res
+	}
+}
+
+// WithDeemphasized grays out the resource, e.g. a historical one
+func WithDeemphasized(deemphasized bool) Option {
+	return func(res PrintableResource) PrintableResource {
+		res.deemphasized = deemphasized
+		return res
+	}
+}
+
+// WithColumns adds columns after the created at one, or replaces the conditions for the "custom" verbose type
+func WithColumns(columns []string) Option {
+	return func(res PrintableResource) PrintableResource {
+		res.columns = columns
+		return res
+	}
+}
+
+// WithQuiet does not print the warnings about missing or unexpected fields, they are still returned by Warnings
+func WithQuiet(quiet bool) Option {
+	return func(res PrintableResource) PrintableResource {
+		res.quiet = quiet
+		return res
+	}
+}
+
+func (res *PrintableResource) warn(format string, args ...interface{}) {
+	res.warnings = append(res.warnings, strings.TrimSpace(fmt.Sprintf(format, args...)))
+	if res.quiet {
+		return
+	}
+	SayWarningMessage(format, args...)
+}
+
+// Warnings returns the warnings about missing or unexpected fields, printed or not
+func (res *PrintableResource) Warnings() []string {
+	return res.warnings
+}
+
 func (res *PrintableResource) appendKeyInfo(keyInfo []string) {
 	res.keyInfo = append(res.keyInfo, keyInfo)
 }
 
+// KeyInfoRows returns the key and value pairs collected by AddKeyInfo
+func (res *PrintableResource) KeyInfoRows() [][]string {
+	return res.keyInfo
+}
+
 func (res *PrintableResource) appendConditions(conditions []string) {
 	res.conditions = append(res.conditions, conditions)
 }
 
+// AddSummary adds a free text row, shown whatever the verbose type is
+func (res *PrintableResource) AddSummary(summary string) {
+	res.appendConditions([]string{summary})
+	res.appendKeyInfo([]string{summary})
+}
+
 func (res *PrintableResource) dumpSubTable(rows [][]string, requireSeperator bool) []string {
 
 	col := 1
@@ -130,13 +196,27 @@ func (res *PrintableResource) DumpResource() [][]string {
 		paddingSubLines = "|"
 	}
 
+	typeName := res.typeName
+	name := res.name
+	if res.highlighted {
+		c := color.New(color.FgCyan).Add(color.Bold)
+		typeName = c.Sprintf("%s", res.typeName)
+	}
+	if res.deemphasized {
+		c := color.New(color.FgHiBlack)
+		typeName = c.Sprintf("%s", res.typeName)
+		name = c.Sprintf("%s", res.name)
+	}
+
 	//make the content
 	data := [][]string{}
 	switch res.verboseType {
 	case "keyinfo":
-		data = res.dumpToMultipleRows(paddingFirstLine, paddingSubLines, res.keyInfo, res.typeName, res.name)
+		data = res.dumpToMultipleRows(paddingFirstLine, paddingSubLines, res.keyInfo, typeName, name)
+	case "custom":
+		data = append(data, append([]string{paddingFirstLine + typeName, name}, res.columns...))
 	default:
-		data = res.dumpToMultipleRows(paddingFirstLine, paddingSubLines, res.conditions, res.typeName, res.name, []string{res.createdAt}...)
+		data = res.dumpToMultipleRows(paddingFirstLine, paddingSubLines, res.conditions, typeName, name, append([]string{res.createdAt}, res.columns...)...)
 	}
 
 	return data
@@ -181,12 +261,10 @@ func (res *PrintableResource) dumpToMultipleRows(paddingFirstLine, paddingSubLin
 
 func (res *PrintableResource) addKeyInfoRows(crName, key string, val interface{}) {
 
-	cWarning := color.New(color.FgYellow).Add(color.Bold)
-
 	switch vv := val.(type) {
 	case []interface{}:
 		//dump [].*
-		cWarning.Printf("Detected slice for %s key %s, recommend to add [*] to retrieve nested fields\n", crName, key)
+		res.warn("Detected slice for %s key %s, recommend to add [*] to retrieve nested fields\n", crName, key)
 		for k, v := range vv {
 			res.appendKeyInfo([]string{fmt.Sprintf("%s[%d]", key, k), fmt.Sprintf("%v", v)})
 		}
@@ -201,21 +279,29 @@ func (res *PrintableResource) addKeyInfoRows(crName, key string, val interface{}
 
 }
 
-func (res *PrintableResource) addKeyInfoSliceDeepFirstRetrieve(keyPrefix string, object map[string]interface{}, depth int, segment []string, crName, objName string) error {
+func (res *PrintableResource) addKeyInfoSliceDeepFirstRetrieve(keyPrefix string, value interface{}, depth int, segment []string, crName, objName string) error {
 
-	if keyPrefix != "" {
-		keyPrefix = keyPrefix + "." + segment[depth]
-	} else {
-		keyPrefix = segment[depth]
-	}
-
-	vv, ok, err := unstructured.NestedFieldNoCopy(object, strings.Split(segment[depth], ".")...)
-	if !ok || err != nil {
-		SayWarningMessage("Missing key info %s for %s %s, %v\n", keyPrefix, crName, objName, err)
-		return nil
+	//an empty segment stands for nested wildcards, e.g. xxx[*][*], the value is the slice item itself
+	if segment[depth] != "" {
+		if keyPrefix != "" {
+			keyPrefix = keyPrefix + "." + segment[depth]
+		} else {
+			keyPrefix = segment[depth]
+		}
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			res.warn("Missing key info %s for %s %s, %v is not an object\n", keyPrefix, crName, objName, value)
+			return nil
+		}
+		vv, ok, err := unstructured.NestedFieldNoCopy(object, strings.Split(segment[depth], ".")...)
+		if !ok || err != nil {
+			res.warn("Missing key info %s for %s %s, %v\n", keyPrefix, crName, objName, err)
+			return nil
+		}
+		value = vv
 	}
 
-	switch val := vv.(type) {
+	switch val := value.(type) {
 	case []interface{}:
 		//handle xxx[*].yyy[*]...
 		if depth == len(segment)-1 {
@@ -225,12 +311,7 @@ func (res *PrintableResource) addKeyInfoSliceDeepFirstRetrieve(keyPrefix string,
 			return nil
 		}
 		for k, v := range val {
-			switch vv := v.(type) {
-			case map[string]interface{}:
-				res.addKeyInfoSliceDeepFirstRetrieve(fmt.Sprintf("%s[%d]", keyPrefix, k), vv, depth+1, segment, crName, objName)
-			default:
-				fmt.Println("should go here222?")
-			}
+			res.addKeyInfoSliceDeepFirstRetrieve(fmt.Sprintf("%s[%d]", keyPrefix, k), v, depth+1, segment, crName, objName)
 		}
 	default:
 		//handle xxx[*].yyy where yyy is a single value or map
@@ -238,24 +319,106 @@ func (res *PrintableResource) addKeyInfoSliceDeepFirstRetrieve(keyPrefix string,
 			res.addKeyInfoRows(crName, keyPrefix, val)
 			return nil
 		}
+		res.warn("Missing key info %s for %s %s, %v is not a slice\n", keyPrefix, crName, objName, val)
 	}
 	return nil
 }
 
-func (res *PrintableResource) AddKeyInfo(keyInfo []string, objectNode *ObjectNode) error {
+// addKeyInfoJSONPath evaluates a client-go JSONPath, the values are keyed by the path, or the label when set,
+// followed by their index when there are several of them
+func (res *PrintableResource) addKeyInfoJSONPath(keyInfo KeyInfoPath, object map[string]interface{}, crName, objName string) {
+	template := strings.TrimPrefix(keyInfo.Path, "$")
+	if !strings.HasPrefix(template, "{") {
+		if !strings.HasPrefix(template, ".") && !strings.HasPrefix(template, "[") {
+			template = "." + template
+		}
+		template = "{" + template + "}"
+	}
+	parser := jsonpath.New(keyInfo.Path).AllowMissingKeys(true)
+	if err := parser.Parse(template); err != nil {
+		res.warn("Invalid key info %s for %s %s, %v\n", keyInfo.Path, crName, objName, err)
+		return
+	}
+	results, err := parser.FindResults(object)
+	if err != nil {
+		res.warn("Missing key info %s for %s %s, %v\n", keyInfo.Path, crName, objName, err)
+		return
+	}
+	values := []interface{}{}
+	for _, result := range results {
+		for _, v := range result {
+			if v.IsValid() && v.CanInterface() {
+				values = append(values, v.Interface())
+			}
+		}
+	}
+	if len(values) == 0 {
+		res.warn("Missing key info %s for %s %s\n", keyInfo.Path, crName, objName)
+		return
+	}
+
+	key := keyInfo.Path
+	if keyInfo.Label != "" {
+		key = keyInfo.Label
+	}
+	for i, v := range values {
+		if len(values) == 1 {
+			res.addKeyInfoRows(crName, key, v)
+		} else {
+			res.addKeyInfoRows(crName, fmt.Sprintf("%s[%d]", key, i), v)
+		}
+	}
+}
+
+// isDottedKeyInfoPath tells whether path uses the dotted syntax with [*] for slices rather than JSONPath
+func isDottedKeyInfoPath(path string) bool {
+	return dottedKeyInfoPath.MatchString(path)
+}
+
+// labelKeyInfoRows renames the rows of a dotted path from index on: the path is replaced by the label,
+// the slice indexes and nested keys are kept, e.g. spec.containers[0].image becomes image[0]
+func (res *PrintableResource) labelKeyInfoRows(keyInfo KeyInfoPath, index int) {
+	if keyInfo.Label == "" {
+		return
+	}
+	parts := strings.Split(keyInfo.Path, "[*]")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	pattern, err := regexp.Compile("^" + strings.Join(parts, `(\[\d+\])`) + "(.*)$")
+	if err != nil {
+		return
+	}
+	for _, row := range res.keyInfo[index:] {
+		if len(row) != 2 {
+			continue
+		}
+		if m := pattern.FindStringSubmatch(row[0]); m != nil {
+			row[0] = keyInfo.Label + strings.Join(m[1:], "")
+		}
+	}
+}
+
+func (res *PrintableResource) AddKeyInfo(keyInfo []KeyInfoPath, objectNode *ObjectNode) error {
 
 	if objectNode == nil || objectNode.Object == nil || objectNode.Object.Object == nil {
-		SayWarningMessage("Failed to load object for %s %s\n", objectNode.CRName, objectNode.ObjectName)
+		res.warn("Failed to load object for %s %s\n", objectNode.CRName, objectNode.ObjectName)
 		return nil
 	}
 
 	object := objectNode.Object.Object
-	for _, key := range keyInfo {
+	for _, info := range keyInfo {
+		key := info.Path
+		if !isDottedKeyInfoPath(key) {
+			res.addKeyInfoJSONPath(info, object, objectNode.CRName, objectNode.ObjectName)
+			continue
+		}
+		index := len(res.keyInfo)
 		if !strings.Contains(key, "[*]") {
 			//no slice included
 			val, ok, err := unstructured.NestedFieldNoCopy(object, strings.Split(key, ".")...)
 			if !ok || err != nil {
-				SayWarningMessage("Missing key info %s for %s %s, %v\n", key, objectNode.CRName, objectNode.ObjectName, err)
+				res.warn("Missing key info %s for %s %s, %v\n", key, objectNode.CRName, objectNode.ObjectName, err)
 				continue
 			}
 			res.addKeyInfoRows(objectNode.CRName, key, val)
@@ -270,71 +433,73 @@ func (res *PrintableResource) AddKeyInfo(keyInfo []string, objectNode *ObjectNod
 			}
 			err := res.addKeyInfoSliceDeepFirstRetrieve("", object, 0, segment, objectNode.CRName, objectNode.ObjectName)
 			if err != nil {
-				SayWarningMessage("Missing key info %s for %s %s, %v\n", key, objectNode.CRName, objectNode.ObjectName, err)
+				res.warn("Missing key info %s for %s %s, %v\n", key, objectNode.CRName, objectNode.ObjectName, err)
 				continue
 			}
 		} //end of else
+		res.labelKeyInfoRows(info, index)
 	}
 
 	return nil
 
 }
 
-func (res *PrintableResource) AddConditions(objectNode *ObjectNode, conditionInfos map[string][]ConditionInfo) error {
+// AddReportConditions adds the conditions of a report node, in the order of conditionInfos when it lists all of
+// them, with the ones which are not as expected highlighted
+func (res *PrintableResource) AddReportConditions(node *ReportNode, conditionInfos map[string][]ConditionInfo) {
 
-	if objectNode == nil || objectNode.Object == nil || objectNode.Object.Object == nil {
-		SayWarningMessage("Failed to load object for %s %s\n", objectNode.CRName, objectNode.ObjectName)
-		return nil
+	if node == nil || node.Object == nil || node.Object.Object == nil {
+		res.warn("Failed to load object for %s %s\n", node.Type, node.Name)
+		return
 	}
 
-	object := objectNode.Object.Object
-	conditions, ok, err := unstructured.NestedSlice(object, strings.Split("status.conditions", ".")...)
-	if !ok || err != nil {
-		if conditionInfo, ok := conditionInfos[objectNode.CRName]; ok && len(conditionInfo) != 0 {
-			SayWarningMessage("Failed to load the status.conditions for %s %s, %v\n", objectNode.CRName, objectNode.ObjectName, err)
-			return nil
+	if _, ok, err := unstructured.NestedSlice(node.Object.Object, "status", "conditions"); !ok || err != nil {
+		if conditionInfo, ok := conditionInfos[node.Type]; ok && len(conditionInfo) != 0 {
+			res.warn("Failed to load the status.conditions for %s %s, %v\n", node.Type, node.Name, err)
 		}
-		return nil
+		return
 	}
 
-	//for fast retrieve
-	conditionMaps := make(map[string]map[string]interface{})
-	for _, condition := range conditions {
-		if m, ok := condition.(map[string]interface{}); ok {
-			if _, ok := m["type"]; ok {
-				conditionMaps[fmt.Sprintf("%v", m["type"])] = m
-			} else {
-				SayWarningMessage("Invalid structure for %s status.conditions %v\n", objectNode.CRName, m)
-				return nil
-			}
-		} else {
-			SayWarningMessage("Invalid structure for %s status.conditions %v\n", objectNode.CRName, condition)
-			return nil
-		}
+	conditions := make(map[string]ReportCondition)
+	for _, condition := range node.Conditions {
+		conditions[condition.Type] = condition
 	}
-
-	//if defined in conditionInfo map, then sort the condition output and check abnormal status from conditionInfo map
-	//if len(conditionInfo) != len(conditions),  the deifnition of conditionInfo is not accurate.
-	if conditionInfo, ok := conditionInfos[objectNode.CRName]; ok && len(conditionInfo) != 0 && len(conditionInfo) == len(conditionMaps) {
+	if conditionInfo, ok := conditionInfos[node.Type]; ok && len(conditionInfo) != 0 && len(conditionInfo) == len(conditions) {
 		for _, v := range conditionInfo {
-			if m, ok := conditionMaps[v.Type]; ok {
-				if _, ok := m["status"]; ok && len(v.Expected) != 0 && strings.Index(v.Expected, fmt.Sprintf("%v", m["status"])) == -1 {
-					res.addConditionRows(m, false)
-				} else {
-					res.addConditionRows(m)
-				}
-			} else {
-				//ignore the condition.type if not defined in conditionInfo or status.conditions
+			if condition, ok := conditions[v.Type]; ok {
+				res.addConditionRows(reportConditionMap(condition), condition.AsExpected)
 			}
 		}
-	} else {
-		for _, condition := range conditions {
-			res.addConditionRows(condition)
-		}
+		return
 	}
+	for _, condition := range node.Conditions {
+		res.addConditionRows(reportConditionMap(condition))
+	}
+}
 
-	return nil
+// reportConditionMap returns the fields of a report condition which are set, as in status.conditions
+func reportConditionMap(condition ReportCondition) map[string]interface{} {
+	m := map[string]interface{}{"type": condition.Type, "status": condition.Status}
+	for key, value := range map[string]string{
+		"lastTransitionTime": condition.LastTransitionTime,
+		"reason":             condition.Reason,
+		"message":            condition.Message,
+	} {
+		if value != "" {
+			m[key] = value
+		}
+	}
+	return m
+}
 
+// AddReportKeyInfo adds the key info of a report node, and warns about the paths which could not be read
+func (res *PrintableResource) AddReportKeyInfo(node *ReportNode) {
+	for _, warning := range node.Warnings {
+		res.warn("%s\n", warning)
+	}
+	for _, info := range node.KeyInfo {
+		res.appendKeyInfo([]string{info.Key, info.Value})
+	}
 }
 
 func (res *PrintableResource) addConditionRows(condition interface{}, asExpected ...bool) {
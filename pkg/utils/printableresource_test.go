@@ -0,0 +1,164 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	. "knative.dev/kn-plugin-diag/pkg/models"
+)
+
+func TestIsDottedKeyInfoPath(t *testing.T) {
+	tests := []struct {
+		path   string
+		dotted bool
+	}{
+		{"spec.traffic", true},
+		{"spec.template.spec.containers[*].image", true},
+		{"status.containerStatuses[*].state[*]", true},
+		{"metadata.annotations.autoscaling.knative.dev/min-scale", true},
+		{".spec.traffic", false},
+		{"spec.containers[0].image", false},
+		{"{.spec.containers[*].image}", false},
+		{"$.spec.traffic[?(@.latestRevision==true)].percent", false},
+		{`metadata.labels['app\.kubernetes\.io/name']`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			assert.Equal(t, isDottedKeyInfoPath(tt.path), tt.dotted)
+		})
+	}
+}
+
+func TestAddKeyInfo(t *testing.T) {
+	node := NewObjectNode("ksvc", "hello", &unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{"labels": map[string]interface{}{"app.kubernetes.io/name": "hello"}},
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{"spec": map[string]interface{}{"containers": []interface{}{
+				map[string]interface{}{"name": "user-container", "image": "hello:v1"},
+				map[string]interface{}{"name": "sidecar", "image": "proxy:v2"},
+			}}},
+			"traffic": []interface{}{
+				map[string]interface{}{"revisionName": "hello-00001", "percent": int64(20)},
+				map[string]interface{}{"latestRevision": true, "percent": int64(80)},
+			},
+		},
+	}})
+	tests := []struct {
+		name    string
+		keyInfo KeyInfoPath
+		want    [][]string
+	}{
+		{
+			name:    "dotted path with [*]",
+			keyInfo: KeyInfoPath{Path: "spec.template.spec.containers[*].image"},
+			want:    [][]string{{"spec.template.spec.containers[0].image", "hello:v1"}, {"spec.template.spec.containers[1].image", "proxy:v2"}},
+		},
+		{
+			name:    "dotted path with a label",
+			keyInfo: KeyInfoPath{Path: "spec.template.spec.containers[*].image", Label: "image"},
+			want:    [][]string{{"image[0]", "hello:v1"}, {"image[1]", "proxy:v2"}},
+		},
+		{
+			name:    "JSONPath filter",
+			keyInfo: KeyInfoPath{Path: "spec.traffic[?(@.latestRevision==true)].percent"},
+			want:    [][]string{{"spec.traffic[?(@.latestRevision==true)].percent", "80"}},
+		},
+		{
+			name:    "JSONPath with several values and a label",
+			keyInfo: KeyInfoPath{Path: "{.spec.traffic[*].percent}", Label: "percent"},
+			want:    [][]string{{"percent[0]", "20"}, {"percent[1]", "80"}},
+		},
+		{
+			name:    "JSONPath escaping a dotted label",
+			keyInfo: KeyInfoPath{Path: `metadata.labels['app\.kubernetes\.io/name']`, Label: "name"},
+			want:    [][]string{{"name", "hello"}},
+		},
+		{
+			name:    "missing field",
+			keyInfo: KeyInfoPath{Path: "spec.traffic[?(@.tag=='canary')].percent"},
+			want:    [][]string{},
+		},
+		{
+			name:    "invalid JSONPath",
+			keyInfo: KeyInfoPath{Path: "{.spec.traffic[}"},
+			want:    [][]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := NewPrintableResource(0, "ksvc", "hello", WithQuiet(true))
+			assert.NilError(t, res.AddKeyInfo([]KeyInfoPath{tt.keyInfo}, node))
+			assert.DeepEqual(t, res.KeyInfoRows(), tt.want)
+		})
+	}
+}
+
+func TestAddReportConditions(t *testing.T) {
+	node := &ReportNode{Type: "ksvc", Name: "hello", Object: &unstructured.Unstructured{Object: map[string]interface{}{
+		"status": map[string]interface{}{"conditions": []interface{}{}},
+	}}}
+	ready := ReportCondition{Type: "Ready", Status: "False", Reason: "RevisionFailed", LastTransitionTime: "2021-06-01T10:00:00Z"}
+	routes := ReportCondition{Type: "RoutesReady", Status: "True", AsExpected: true}
+	tests := []struct {
+		name       string
+		conditions []ReportCondition
+		want       [][]string
+	}{
+		{
+			name:       "all listed in the order of the condition info",
+			conditions: []ReportCondition{routes, ready, {Type: "ConfigurationsReady", Status: "True", AsExpected: true}},
+			want: [][]string{
+				{"ConfigurationsReady", "True"},
+				{"RoutesReady", "True"},
+				{"2021-06-01T10:00:00Z", "Ready", "False", "RevisionFailed"},
+			},
+		},
+		{
+			name:       "some missing in the order of the object",
+			conditions: []ReportCondition{routes, ready},
+			want: [][]string{
+				{"RoutesReady", "True"},
+				{"2021-06-01T10:00:00Z", "Ready", "False", "RevisionFailed"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node.Conditions = tt.conditions
+			res := NewPrintableResource(0, node.Type, node.Name, WithQuiet(true))
+			res.AddReportConditions(node, LoadServingConditionInfoConfiguration())
+			assert.DeepEqual(t, res.conditions, tt.want)
+		})
+	}
+}
+
+func TestAddReportKeyInfo(t *testing.T) {
+	node := &ReportNode{
+		Type:     "ksvc",
+		Name:     "hello",
+		KeyInfo:  []KeyInfo{{Key: "spec.template.spec.containers[0].image", Value: "hello:v1"}},
+		Warnings: []string{"Missing key info spec.traffic for ksvc hello, <nil>"},
+	}
+	res := NewPrintableResource(0, node.Type, node.Name, WithVerboseType("keyinfo"), WithQuiet(true))
+	res.AddReportKeyInfo(node)
+	assert.DeepEqual(t, res.KeyInfoRows(), [][]string{{"spec.template.spec.containers[0].image", "hello:v1"}})
+	assert.DeepEqual(t, res.Warnings(), node.Warnings)
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Redacted replaces the sensitive values
+const Redacted = "<redacted>"
+
+var (
+	// defaultRedactPatterns match the sensitive parts of any string value or log line. The first submatch,
+	// if any, is kept in front of the redacted part and the second one after it.
+	defaultRedactPatterns = []string{
+		`(?i)(bearer\s+)[a-z0-9\-._~+/]+=*`,
+		`eyJ[a-zA-Z0-9_-]+\.[a-zA-Z0-9_-]+\.[a-zA-Z0-9_-]+`,
+		`AKIA[0-9A-Z]{16}`,
+		`(?i)((?:password|passwd|token|secret|api[-_]?key)\s*[=:]\s*)[^\s,;"']+`,
+		`("auth"\s*:\s*)"[^"]+"`,
+		//the userinfo of a URL, the @ tells it apart from a port
+		`(://[^/\s:@]+:)[^/\s@]+(@)`,
+	}
+
+	// sensitiveKey matches the annotation and data keys whose whole value is redacted. The sensitive word
+	// must be the last segment of the key, e.g. db.password or api-token but not queue-sidecar-token-audiences.
+	sensitiveKey = regexp.MustCompile(`(?i)(^|[._/-])(password|passwd|token|secret|credentials?|auth|(api|access|secret|private|signing|encryption)[-_]?key|(tls|ssh)[._-]key|dockerconfigjson|dockercfg|last-applied-configuration)$`)
+
+	// camelCaseBoundary splits the words of camelCase keys, e.g. dbPassword
+	camelCaseBoundary = regexp.MustCompile(`([a-z0-9])([A-Z])`)
+)
+
+// Redactor hides the sensitive values of objects and texts before they are printed or bundled.
+// A nil Redactor leaves everything as is.
+type Redactor struct {
+	patterns []*regexp.Regexp
+}
+
+// NewRedactor returns a Redactor using the built-in patterns and the extraPatterns regular expressions
+func NewRedactor(extraPatterns []string) (*Redactor, error) {
+	r := &Redactor{}
+	for _, pattern := range append(append([]string{}, defaultRedactPatterns...), extraPatterns...) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid redact pattern %s, %v", pattern, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// RedactText replaces the parts of text matching a pattern
+func (r *Redactor) RedactText(text string) string {
+	if r == nil {
+		return text
+	}
+	for _, re := range r.patterns {
+		replacement := Redacted
+		switch {
+		case re.NumSubexp() > 1:
+			replacement = "${1}" + Redacted + "${2}"
+		case re.NumSubexp() > 0:
+			replacement = "${1}" + Redacted
+		}
+		text = re.ReplaceAllString(text, replacement)
+	}
+	return text
+}
+
+// RedactObject redacts in place the environment values of containers, the data of Secrets,
+// the annotations and ConfigMap keys looking sensitive, at any depth, and every string matching a pattern
+func (r *Redactor) RedactObject(obj map[string]interface{}) {
+	if r == nil || obj == nil {
+		return
+	}
+	kind, _ := obj["kind"].(string)
+	if kind == "Secret" {
+		redactAllValues(obj["data"])
+		redactAllValues(obj["stringData"])
+	}
+	if kind == "ConfigMap" {
+		redactSensitiveKeys(obj["data"])
+	}
+	r.redactValue(obj)
+}
+
+func (r *Redactor) redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, nested := range v {
+			switch key {
+			case "env":
+				redactEnvValues(nested)
+			case "annotations":
+				redactSensitiveKeys(nested)
+			}
+			v[key] = r.redactValue(nested)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = r.redactValue(item)
+		}
+	case string:
+		return r.RedactText(v)
+	}
+	return value
+}
+
+// redactEnvValues redacts the literal values of a container env, the references are kept
+func redactEnvValues(env interface{}) {
+	items, ok := env.([]interface{})
+	if !ok {
+		return
+	}
+	for _, item := range items {
+		if m, ok := item.(map[string]interface{}); ok {
+			if _, ok := m["value"]; ok {
+				m["value"] = Redacted
+			}
+		}
+	}
+}
+
+func redactSensitiveKeys(data interface{}) {
+	m, ok := data.(map[string]interface{})
+	if !ok {
+		return
+	}
+	for key := range m {
+		if isSensitiveKey(key) {
+			m[key] = Redacted
+		}
+	}
+}
+
+func isSensitiveKey(key string) bool {
+	return sensitiveKey.MatchString(camelCaseBoundary.ReplaceAllString(key, "${1}-${2}"))
+}
+
+func redactAllValues(data interface{}) {
+	m, ok := data.(map[string]interface{})
+	if !ok {
+		return
+	}
+	for key := range m {
+		m[key] = Redacted
+	}
+}
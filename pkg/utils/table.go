@@ -19,9 +19,7 @@ package utils
 import (
 	"fmt"
 	"io"
-	"os"
 	"strings"
-	"unicode/utf8"
 
 	"github.com/fatih/color"
 	terminal "github.com/wayneashleyberry/terminal-dimensions"
@@ -99,32 +97,36 @@ func (t *PrintableTable) PrintDump(wrapEnabled bool) []string {
 			continue
 		}
 		line := t.printRowString(row)
-		if len(line) > maxSize {
-			maxSize = len(line)
+		lineWidth := VisibleWidth(line)
+		if lineWidth > maxSize {
+			maxSize = lineWidth
 		}
-		if len(line) < t.terminalWidth {
+		if lineWidth < t.terminalWidth {
 			dumps = append(dumps, line)
 			continue
 		}
+		//the widths are counted on the visible runes, and the lines are cut between escape codes
+		head, tail := SplitVisible(line, t.terminalWidth)
+		dumps = append(dumps, head)
 		if !wrapEnabled {
-			dumps = append(dumps, line[0:t.terminalWidth])
 			continue
 		}
 
-		dumps = append(dumps, line[0:t.terminalWidth])
-		lengthofplaceholder := strings.Index(line, "| ")
-		if lengthofplaceholder == -1 {
-			lengthofplaceholder = strings.Index(line, "|---") + 4
+		placeholder := strings.Index(line, "| ")
+		if placeholder == -1 {
+			placeholder = strings.Index(line, "|---") + 4
 		}
-		if lengthofplaceholder != -1 && lengthofplaceholder < 2*t.terminalWidth {
-			linewraping := line[t.terminalWidth:]
-			if len(linewraping) > t.terminalWidth-lengthofplaceholder && len(line) > 2*t.terminalWidth-lengthofplaceholder {
-				linewraping = line[t.terminalWidth : 2*t.terminalWidth-lengthofplaceholder-1]
+		if placeholder >= 0 && placeholder <= len(line) {
+			lengthofplaceholder := VisibleWidth(line[:placeholder])
+			room := t.terminalWidth - lengthofplaceholder - 1
+			if room <= 0 {
+				continue
 			}
-			paddinglength := t.terminalWidth - lengthofplaceholder - 1 - len(linewraping)
-			if paddinglength < 0 {
-				paddinglength = 0
+			linewraping := tail
+			if VisibleWidth(linewraping) > room {
+				linewraping, _ = SplitVisible(linewraping, room)
 			}
+			paddinglength := room - VisibleWidth(linewraping)
 			dumps = append(dumps, strings.Repeat(" ", lengthofplaceholder)+"|"+strings.Repeat(" ", paddinglength)+linewraping)
 		}
 
@@ -159,7 +161,7 @@ func (t *PrintableTable) Print() {
 
 func (t *PrintableTable) calculateMaxSize(row []string) {
 	for index, value := range row {
-		cellLength := utf8.RuneCountInString(value)
+		cellLength := VisibleWidth(value)
 		if t.maxSizes[index] < cellLength {
 			t.maxSizes[index] = cellLength
 		}
@@ -172,8 +174,8 @@ func (t *PrintableTable) printHeader() {
 		output = output + t.cellValue(col, value)
 	}
 	output = strings.TrimRight(output, "| ")
-	//skip colorized when output to file
-	if t.writer == os.Stdout {
+	//skip colorized when output to a file or a pipe
+	if !color.NoColor && IsTerminal(t.writer) {
 		c := color.New(color.FgWhite).Add(color.Bold)
 		c.Fprintln(t.writer, output)
 	} else {
@@ -185,9 +187,6 @@ func (t *PrintableTable) printHeader() {
 func (t *PrintableTable) printRow(row []string) {
 	output := ""
 	for columnIndex, value := range row {
-		if columnIndex == 0 {
-			value = value
-		}
 		output = output + t.cellValue(columnIndex, value)
 	}
 	output = strings.TrimRight(output, "| ")
@@ -197,19 +196,16 @@ func (t *PrintableTable) printRow(row []string) {
 func (t *PrintableTable) printRowString(row []string) string {
 	output := ""
 	for columnIndex, value := range row {
-		if columnIndex == 0 {
-			value = value
-		}
 		output = output + t.cellValue(columnIndex, value)
 	}
 	output = strings.TrimRight(output, "| ")
-	return fmt.Sprintf(output)
+	return output
 }
 
 func (t *PrintableTable) cellValue(col int, value string) string {
 	padding := ""
 	if col < len(t.headers)-1 {
-		padding = strings.Repeat(" ", t.maxSizes[col]-utf8.RuneCountInString(value))
+		padding = strings.Repeat(" ", t.maxSizes[col]-VisibleWidth(value))
 	}
 	if t.requireSeperator {
 		return fmt.Sprintf("%s%s    | ", value, padding)
@@ -18,6 +18,7 @@ package utils
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/fatih/color"
 )
@@ -45,3 +46,14 @@ func SayFailedMessage(format string, args ...interface{}) {
 	c := color.New(color.FgRed).Add(color.Bold)
 	c.Printf(format, args...)
 }
+
+// JoinNonEmpty joins the parts which are not empty with sep
+func JoinNonEmpty(sep string, parts ...string) string {
+	kept := []string{}
+	for _, part := range parts {
+		if part != "" {
+			kept = append(kept, part)
+		}
+	}
+	return strings.Join(kept, sep)
+}
@@ -77,6 +77,7 @@ func TestKnDiagPlugin(t *testing.T) {
 	knResultOut := e2eTest.kn.Run("service", "create", ksvcName, "--image", "ghcr.io/knative/autoscale-go:latest")
 	r.AssertNoError(knResultOut)
 
+	e2eTest.testKnDiagWait(t, r, ksvcName)
 	e2eTest.testKnDiagDefault(t, r, ksvcName)
 	e2eTest.testKnDiagKeyInfo(t, r, ksvcName)
 
@@ -98,3 +99,9 @@ func (et *e2eTest) testKnDiagKeyInfo(t *testing.T, r *test.KnRunResultCollector,
 	assert.Check(t, util.ContainsAll(out.Stdout, "ksvc", ksvcName, "status.url"))
 	assert.Check(t, util.ContainsAll(out.Stdout, "revision", ksvcName, "spec.replicas"))
 }
+
+func (et *e2eTest) testKnDiagWait(t *testing.T, r *test.KnRunResultCollector, ksvcName string) {
+	out := et.kn.Run(pluginName, "wait", ksvcName, "--timeout", "2m")
+	r.AssertNoError(out)
+	assert.Check(t, util.ContainsAll(out.Stdout, "ksvc", ksvcName, "is ready"))
+}